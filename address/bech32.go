@@ -0,0 +1,108 @@
+// Package address converts bech32 account addresses between chain prefixes,
+// e.g. the `osmo1...` sender of an IBC transfer to its `evmos1...` address
+package address
+
+import (
+	"fmt"
+	"strings"
+)
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var generator = []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// ConvertPrefix returns the address with the same bytes under the given prefix
+func ConvertPrefix(addr, prefix string) (string, error) {
+	hrp, data, err := decode(addr)
+	if err != nil {
+		return "", err
+	}
+	if hrp == prefix {
+		return strings.ToLower(addr), nil
+	}
+	return encode(prefix, data), nil
+}
+
+// Prefix returns the human readable prefix of the address
+func Prefix(addr string) (string, error) {
+	hrp, _, err := decode(addr)
+	return hrp, err
+}
+
+// decode validates the bech32 string and returns its prefix and 5 bit data without the checksum
+func decode(s string) (string, []byte, error) {
+	if len(s) < 8 || len(s) > 90 {
+		return "", nil, fmt.Errorf("invalid address length %v", len(s))
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, fmt.Errorf("address %q has mixed case", s)
+	}
+	s = strings.ToLower(s)
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, fmt.Errorf("address %q has an invalid separator position", s)
+	}
+
+	hrp := s[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("address %q has an invalid prefix character %q", s, hrp[i])
+		}
+	}
+	data := make([]byte, 0, len(s)-sep-1)
+	for _, c := range s[sep+1:] {
+		i := strings.IndexRune(charset, c)
+		if i < 0 {
+			return "", nil, fmt.Errorf("address %q has an invalid character %q", s, c)
+		}
+		data = append(data, byte(i))
+	}
+	if polymod(append(expandPrefix(hrp), data...)) != 1 {
+		return "", nil, fmt.Errorf("address %q has an invalid checksum", s)
+	}
+	return hrp, data[:len(data)-6], nil
+}
+
+// encode returns the bech32 string of the prefix and 5 bit data adding the checksum
+func encode(hrp string, data []byte) string {
+	values := append(expandPrefix(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	mod := polymod(values) ^ 1
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range data {
+		sb.WriteByte(charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(charset[(mod>>uint(5*(5-i)))&31])
+	}
+	return sb.String()
+}
+
+func expandPrefix(hrp string) []byte {
+	values := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	return values
+}
+
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
@@ -0,0 +1,122 @@
+package address
+
+import (
+	"strings"
+	"testing"
+)
+
+// The BIP-173 test vectors
+var (
+	validBech32 = []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"11" + strings.Repeat("q", 82) + "c8247j",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	}
+	invalidBech32 = []struct {
+		name, s string
+	}{
+		{"prefix character out of range", "\x201nwldj5"},
+		{"prefix delete character", "\x7f1axkwrx"},
+		{"prefix non ascii character", "\x801eym55h"},
+		{"too long", "an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx"},
+		{"no separator", "pzry9x0s0muk"},
+		{"empty prefix", "1pzry9x0s0muk"},
+		{"invalid data character", "x1b4n0q5v"},
+		{"too short checksum", "li1dgmt3"},
+		{"invalid checksum character", "de1lg7wt\xff"},
+		{"checksum of the uppercase prefix", "A1G7SGD8"},
+		{"empty prefix and data", "10a06t8"},
+		{"empty prefix with data", "1qzzfhee"},
+		{"mixed case", "evmos16T3l6qj8s48cu87yrpfuedevt7u2fl37h95raj"},
+	}
+)
+
+func TestDecode(t *testing.T) {
+	for _, s := range validBech32 {
+		hrp, data, err := decode(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		// Encoding the decoded data gives back the lowercase string
+		if got := encode(hrp, data); got != strings.ToLower(s) {
+			t.Errorf("got %q encoding %q, want it lowercase", got, s)
+		}
+	}
+	for _, tc := range invalidBech32 {
+		if _, _, err := decode(tc.s); err == nil {
+			t.Errorf("%v: expected %q to be invalid", tc.name, tc.s)
+		}
+	}
+}
+
+// The pairs were converted with the BIP-173 reference implementation
+var addressPairs = []struct {
+	evmos, osmo, cosmos string
+}{
+	{
+		"evmos16t3l6qj8s48cu87yrpfuedevt7u2fl37h95raj",
+		"osmo16t3l6qj8s48cu87yrpfuedevt7u2fl37alka3g",
+		"cosmos16t3l6qj8s48cu87yrpfuedevt7u2fl374y9d86",
+	},
+	{
+		"evmos1mz8ewhmyk62aufnlhwshc9tc5746w9dqltp9yc",
+		"osmo1mz8ewhmyk62aufnlhwshc9tc5746w9dq43rmgz",
+		"cosmos1mz8ewhmyk62aufnlhwshc9tc5746w9dqa2st7s",
+	},
+}
+
+func TestConvertPrefix(t *testing.T) {
+	convert := func(addr, prefix, want string) {
+		t.Helper()
+		got, err := ConvertPrefix(addr, prefix)
+		if err != nil {
+			t.Errorf("converting %v to %v: %v", addr, prefix, err)
+		} else if got != want {
+			t.Errorf("got %v converting %v to %v, want %v", got, addr, prefix, want)
+		}
+	}
+	for _, p := range addressPairs {
+		convert(p.evmos, "osmo", p.osmo)
+		convert(p.osmo, "evmos", p.evmos)
+		convert(p.cosmos, "osmo", p.osmo)
+		convert(p.evmos, "evmos", p.evmos)
+		convert(strings.ToUpper(p.osmo), "evmos", p.evmos)
+		convert(strings.ToUpper(p.evmos), "evmos", p.evmos)
+	}
+}
+
+func TestConvertPrefixErrors(t *testing.T) {
+	for _, p := range addressPairs {
+		// Every single character change is caught by the checksum
+		last := p.osmo[len(p.osmo)-1]
+		flipped := p.osmo[:len(p.osmo)-1] + string(charset[(strings.IndexByte(charset, last)+1)%len(charset)])
+		// The checksum of the evmos address under the osmo prefix
+		swapped := "osmo" + strings.TrimPrefix(p.evmos, "evmos")
+		for _, addr := range []string{flipped, swapped, p.osmo[:len(p.osmo)-1]} {
+			if got, err := ConvertPrefix(addr, "evmos"); err == nil {
+				t.Errorf("got %v converting %v, want an invalid checksum", got, addr)
+			}
+		}
+	}
+	if _, err := ConvertPrefix("evmos1", "osmo"); err == nil {
+		t.Error("expected an error for an address without data")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	for _, p := range addressPairs {
+		for addr, want := range map[string]string{p.evmos: "evmos", p.osmo: "osmo", strings.ToUpper(p.cosmos): "cosmos"} {
+			if got, err := Prefix(addr); err != nil || got != want {
+				t.Errorf("got prefix %q and error %v of %v, want %q", got, err, addr, want)
+			}
+		}
+	}
+	if _, err := Prefix("evmos1abc"); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
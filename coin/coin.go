@@ -0,0 +1,109 @@
+// Package coin parses the cosmos sdk coin strings found on the events, e.g.
+// `28632956310199211658aevmos` or `100aevmos,5ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2`
+package coin
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	denomRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9/:._-]{2,127}$`)
+	coinRegex  = regexp.MustCompile(`^([0-9]+)[[:space:]]*([a-zA-Z][a-zA-Z0-9/:._-]{2,127})$`)
+)
+
+// Coin is an amount of a single denom
+type Coin struct {
+	Denom  string
+	Amount *big.Int
+}
+
+// String returns the coin in the sdk format, e.g. `100aevmos`
+func (c Coin) String() string {
+	return c.Amount.String() + c.Denom
+}
+
+// Coins is a list of coins sorted by denom without duplicates
+type Coins []Coin
+
+// String returns the coins in the sdk format, e.g. `100aevmos,5uosmo`
+func (cs Coins) String() string {
+	parts := make([]string, len(cs))
+	for i, c := range cs {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// AmountOf returns the amount of the given denom, zero if it is not present
+func (cs Coins) AmountOf(denom string) *big.Int {
+	for _, c := range cs {
+		if c.Denom == denom {
+			return new(big.Int).Set(c.Amount)
+		}
+	}
+	return big.NewInt(0)
+}
+
+// Denoms returns the denoms of the coins
+func (cs Coins) Denoms() []string {
+	denoms := make([]string, len(cs))
+	for i, c := range cs {
+		denoms[i] = c.Denom
+	}
+	return denoms
+}
+
+// ValidateDenom checks the denom follows the sdk rules
+func ValidateDenom(denom string) error {
+	if !denomRegex.MatchString(denom) {
+		return fmt.Errorf("invalid denom %q", denom)
+	}
+	return nil
+}
+
+// ParseCoin parses a single coin, e.g. `100aevmos`
+func ParseCoin(s string) (Coin, error) {
+	matches := coinRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if matches == nil {
+		return Coin{}, fmt.Errorf("invalid coin %q", s)
+	}
+	amount, ok := new(big.Int).SetString(matches[1], 10)
+	if !ok {
+		return Coin{}, fmt.Errorf("invalid amount on coin %q", s)
+	}
+	return Coin{Denom: matches[2], Amount: amount}, nil
+}
+
+// ParseCoins parses a comma separated list of coins, e.g. `100aevmos,5uosmo`.
+// An empty string is an empty list. Zero amounts are dropped, the result is sorted
+// by denom and repeated denoms are rejected.
+func ParseCoins(s string) (Coins, error) {
+	s = strings.TrimSpace(s)
+	coins := Coins{}
+	if s == "" {
+		return coins, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		c, err := ParseCoin(part)
+		if err != nil {
+			return nil, err
+		}
+		if seen[c.Denom] {
+			return nil, fmt.Errorf("duplicate denom %q on coins %q", c.Denom, s)
+		}
+		seen[c.Denom] = true
+		if c.Amount.Sign() == 0 {
+			continue
+		}
+		coins = append(coins, c)
+	}
+
+	sort.Slice(coins, func(i, j int) bool { return coins[i].Denom < coins[j].Denom })
+	return coins, nil
+}
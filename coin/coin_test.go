@@ -0,0 +1,98 @@
+package coin
+
+import (
+	"strings"
+	"testing"
+)
+
+const ibcDenom = "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"
+
+func TestParseCoins(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"blank", "  ", ""},
+		{"single", "28632956310199211658aevmos", "28632956310199211658aevmos"},
+		{"beyond int64", "123456789012345678901234567890aevmos", "123456789012345678901234567890aevmos"},
+		{"sorted by denom", "5uosmo,100aevmos", "100aevmos,5uosmo"},
+		{"ibc denom", "100aevmos,5" + ibcDenom, "100aevmos,5" + ibcDenom},
+		{"spaces", " 100 aevmos , 5uosmo ", "100aevmos,5uosmo"},
+		{"zero amounts dropped", "0aevmos,5uosmo", "5uosmo"},
+		{"leading zeros", "007aevmos", "7aevmos"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			coins, err := ParseCoins(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := coins.String(); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseCoinsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"no amount", "aevmos", "invalid coin"},
+		{"no denom", "100", "invalid coin"},
+		{"negative", "-5aevmos", "invalid coin"},
+		{"decimal", "1.5aevmos", "invalid coin"},
+		{"short denom", "5ab", "invalid coin"},
+		{"denom starting with a digit", "5 1abc", "invalid coin"},
+		{"invalid character", "5 aevmos!", "invalid coin"},
+		{"empty part", "100aevmos,,5uosmo", "invalid coin"},
+		{"trailing comma", "100aevmos,", "invalid coin"},
+		{"duplicate denom", "1aevmos,2aevmos", "duplicate denom"},
+		{"duplicate zero denom", "0aevmos,2aevmos", "duplicate denom"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := ParseCoins(tc.in); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v and error %v, want an error containing %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestAmountOf(t *testing.T) {
+	coins, err := ParseCoins("100aevmos,5" + ibcDenom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := coins.AmountOf("aevmos"); got.String() != "100" {
+		t.Errorf("got %v aevmos, want 100", got)
+	}
+	if got := coins.AmountOf("uosmo"); got.Sign() != 0 {
+		t.Errorf("got %v uosmo, want 0", got)
+	}
+	// The amount returned is a copy
+	coins.AmountOf("aevmos").SetInt64(1)
+	if got := coins.AmountOf("aevmos"); got.String() != "100" {
+		t.Errorf("got %v aevmos after modifying a returned amount, want 100", got)
+	}
+	if got := strings.Join(coins.Denoms(), ","); got != "aevmos,"+ibcDenom {
+		t.Errorf("got denoms %v", got)
+	}
+}
+
+func TestValidateDenom(t *testing.T) {
+	for _, denom := range []string{"aevmos", "uosmo", ibcDenom, "gamm/pool/1", "a:b.c_d-e"} {
+		if err := ValidateDenom(denom); err != nil {
+			t.Errorf("denom %q: %v", denom, err)
+		}
+	}
+	for _, denom := range []string{"", "ab", "1abc", "evmos!", strings.Repeat("a", 129)} {
+		if err := ValidateDenom(denom); err == nil {
+			t.Errorf("expected denom %q to be invalid", denom)
+		}
+	}
+}
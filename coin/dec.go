@@ -0,0 +1,148 @@
+package coin
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Precision is the amount of decimals of a Dec, the 18 decimals between aevmos and evmos
+const Precision = 18
+
+var (
+	precisionMultiplier = new(big.Int).Exp(big.NewInt(10), big.NewInt(Precision), nil)
+	decRegex            = regexp.MustCompile(`^(-?)([0-9]+)(?:\.([0-9]{1,18}))?$`)
+)
+
+// Dec is an exact fixed point decimal with 18 decimals, e.g. an amount of evmos.
+// It is stored on the database as its text representation.
+type Dec struct {
+	// i is the decimal scaled by 10^18, e.g. an amount of aevmos
+	i *big.Int
+}
+
+// NewDecFromAtto returns the decimal of an amount of the base denom, e.g. aevmos to evmos
+func NewDecFromAtto(amount *big.Int) Dec {
+	return Dec{i: new(big.Int).Set(amount)}
+}
+
+// ZeroDec returns a decimal of value zero
+func ZeroDec() Dec {
+	return Dec{i: big.NewInt(0)}
+}
+
+// ParseDec parses a decimal with up to 18 decimals, e.g. `-1.5`
+func ParseDec(s string) (Dec, error) {
+	m := decRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Dec{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	digits := m[2] + m[3] + strings.Repeat("0", Precision-len(m[3]))
+	i, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Dec{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if m[1] == "-" {
+		i.Neg(i)
+	}
+	return Dec{i: i}, nil
+}
+
+// Atto returns the decimal scaled by 10^18, e.g. the amount of aevmos
+func (d Dec) Atto() *big.Int {
+	return new(big.Int).Set(d.int())
+}
+
+// Add returns the sum of both decimals
+func (d Dec) Add(other Dec) Dec {
+	return Dec{i: new(big.Int).Add(d.int(), other.int())}
+}
+
+// Sign returns -1, 0 or 1 depending on the sign of the decimal
+func (d Dec) Sign() int {
+	return d.int().Sign()
+}
+
+// Cmp compares both decimals returning -1, 0 or 1
+func (d Dec) Cmp(other Dec) int {
+	return d.int().Cmp(other.int())
+}
+
+// String returns the decimal with all its 18 decimals, e.g. `1.500000000000000000`
+func (d Dec) String() string {
+	return d.Format(Precision)
+}
+
+// Format returns the decimal rounded half away from zero to the given amount of decimals
+func (d Dec) Format(precision int) string {
+	if precision < 0 {
+		precision = 0
+	}
+	if precision > Precision {
+		precision = Precision
+	}
+
+	abs := new(big.Int).Abs(d.int())
+	if precision < Precision {
+		unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Precision-precision)), nil)
+		quo, rem := new(big.Int).QuoRem(abs, unit, new(big.Int))
+		if rem.Mul(rem, big.NewInt(2)).Cmp(unit) >= 0 {
+			quo.Add(quo, big.NewInt(1))
+		}
+		abs = quo
+	}
+
+	digits := abs.String()
+	if len(digits) <= precision {
+		digits = strings.Repeat("0", precision-len(digits)+1) + digits
+	}
+	s := digits
+	if precision > 0 {
+		s = digits[:len(digits)-precision] + "." + digits[len(digits)-precision:]
+	}
+	if d.Sign() < 0 && abs.Sign() != 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// Value stores the decimal as text
+func (d Dec) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan reads a decimal stored as text, an empty or null value is zero
+func (d *Dec) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*d = ZeroDec()
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("can not scan %T into a decimal", src)
+	}
+	if s == "" {
+		*d = ZeroDec()
+		return nil
+	}
+	parsed, err := ParseDec(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// int returns the scaled value treating the zero Dec as zero
+func (d Dec) int() *big.Int {
+	if d.i == nil {
+		return big.NewInt(0)
+	}
+	return d.i
+}
@@ -0,0 +1,123 @@
+package coin
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseDec(t *testing.T) {
+	tests := []struct {
+		in   string
+		atto string
+	}{
+		{"0", "0"},
+		{"1", "1000000000000000000"},
+		{"-1.5", "-1500000000000000000"},
+		{"0.000000000000000001", "1"},
+		{"28.632956310199211658", "28632956310199211658"},
+		{" 2.5 ", "2500000000000000000"},
+		{"123456789012345678901234567890.123456789012345678", "123456789012345678901234567890123456789012345678"},
+	}
+	for _, tc := range tests {
+		d, err := ParseDec(tc.in)
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if got := d.Atto().String(); got != tc.atto {
+			t.Errorf("%q: got %v, want %v", tc.in, got, tc.atto)
+		}
+	}
+
+	for _, s := range []string{"", "1.", ".5", "1.0000000000000000001", "1e18", "+1", "1,5", "- 1"} {
+		if _, err := ParseDec(s); err == nil {
+			t.Errorf("expected %q to be invalid", s)
+		}
+	}
+}
+
+func TestDecFormat(t *testing.T) {
+	atto := func(s string) Dec {
+		i, _ := new(big.Int).SetString(s, 10)
+		return NewDecFromAtto(i)
+	}
+	tests := []struct {
+		d         Dec
+		precision int
+		want      string
+	}{
+		{atto("28632956310199211658"), 18, "28.632956310199211658"},
+		{atto("28632956310199211658"), 6, "28.632956"},
+		{atto("28632956310199211658"), 2, "28.63"},
+		{atto("28632956310199211658"), 0, "29"},
+		// Halves round away from zero
+		{atto("1500000000000000000"), 0, "2"},
+		{atto("2500000000000000000"), 0, "3"},
+		{atto("-2500000000000000000"), 0, "-3"},
+		{atto("1"), 18, "0.000000000000000001"},
+		{atto("1"), 6, "0.000000"},
+		{atto("500000000000"), 6, "0.000001"},
+		// A negative amount rounded to zero has no sign
+		{atto("-1"), 6, "0.000000"},
+		{atto("80"), 30, "0.000000000000000080"},
+		{atto("1000000000000000000"), -1, "1"},
+		{Dec{}, 2, "0.00"},
+	}
+	for _, tc := range tests {
+		if got := tc.d.Format(tc.precision); got != tc.want {
+			t.Errorf("%v with %v decimals: got %q, want %q", tc.d.Atto(), tc.precision, got, tc.want)
+		}
+	}
+}
+
+func TestDecArithmetic(t *testing.T) {
+	a, _ := ParseDec("1.000000000000000001")
+	b, _ := ParseDec("-0.000000000000000002")
+	sum := a.Add(b)
+	if sum.String() != "0.999999999999999999" || sum.Cmp(a) >= 0 || sum.Sign() != 1 {
+		t.Errorf("got sum %v", sum)
+	}
+	if ZeroDec().Add(Dec{}).Sign() != 0 || b.Sign() != -1 {
+		t.Error("got wrong signs")
+	}
+	// The amount is copied in and out
+	amount := big.NewInt(5)
+	d := NewDecFromAtto(amount)
+	amount.SetInt64(6)
+	d.Atto().SetInt64(7)
+	if d.Atto().Int64() != 5 {
+		t.Errorf("got %v, want the 5 the decimal was created with", d.Atto())
+	}
+}
+
+func TestDecValueAndScan(t *testing.T) {
+	d, _ := ParseDec("28.632956310199211658")
+	v, err := d.Value()
+	if err != nil || v != "28.632956310199211658" {
+		t.Fatalf("got value %v and error %v", v, err)
+	}
+
+	for _, src := range []interface{}{"28.632956310199211658", []byte("28.632956310199211658")} {
+		var scanned Dec
+		if err := scanned.Scan(src); err != nil {
+			t.Fatalf("scanning %T: %v", src, err)
+		}
+		if scanned.Cmp(d) != 0 {
+			t.Errorf("scanning %T: got %v, want %v", src, scanned, d)
+		}
+	}
+
+	for _, src := range []interface{}{nil, "", []byte{}} {
+		scanned, _ := ParseDec("1")
+		if err := scanned.Scan(src); err != nil || scanned.Sign() != 0 {
+			t.Errorf("scanning %#v: got %v and error %v, want zero", src, scanned, err)
+		}
+	}
+
+	for _, src := range []interface{}{"evmos", []byte("1.5.5"), int64(1), 1.5} {
+		var scanned Dec
+		if err := scanned.Scan(src); err == nil {
+			t.Errorf("expected scanning %#v to fail", src)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facs95/decay-data/address"
+	"github.com/facs95/decay-data/coin"
+	"github.com/facs95/decay-data/query"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is the config file loaded when no other is provided, if it exists
+const DefaultPath = "./config.yaml"
+
+// Config holds the settings shared by all the commands.
+// Values are read from the defaults, then the config file, then the environment.
+type Config struct {
+	DBPath         string   `yaml:"db_path"`
+	LogPath        string   `yaml:"log_path"`
+	DecayLogPath   string   `yaml:"decay_log_path"`
+	GenesisPath    string   `yaml:"genesis_path"`
+	BatchSize      int      `yaml:"batch_size"`
+	MaxWorkers     int      `yaml:"max_workers"`
+	RPCEndpoints   []string `yaml:"rpc_endpoints"`
+	RPCMaxAttempts int      `yaml:"rpc_max_attempts"`
+	// ClaimsDenom is the denom the claims module pays the claimed amounts in
+	ClaimsDenom string `yaml:"claims_denom"`
+	// BlocksDir replaces the rpc endpoints with a directory of `<height>.json` block results
+	BlocksDir string `yaml:"blocks_dir"`
+	// DisplayPrecision is the amount of decimals of the evmos amounts on reports
+	DisplayPrecision int `yaml:"display_precision"`
+	// ReimbursementFrom is the address paying the reimbursements
+	ReimbursementFrom string `yaml:"reimbursement_from"`
+	// ReimbursementChunkSize is the amount of payments per multi-send transaction
+	ReimbursementChunkSize int `yaml:"reimbursement_chunk_size"`
+	// ReimbursementDust is the amount of the claims denom a loss must exceed to be reimbursed
+	ReimbursementDust string `yaml:"reimbursement_dust"`
+	// ReimbursementDir is the directory the transactions and manifest are written to
+	ReimbursementDir string `yaml:"reimbursement_dir"`
+	// EventRules define which events are collected and how they are stored
+	EventRules []EventRule `yaml:"event_rules"`
+	// CorrectSchedule overrides the genesis claims params to get the decay schedule that should have been applied
+	CorrectSchedule *ScheduleOverride `yaml:"correct_schedule"`
+	// BuggySchedule overrides the genesis claims params to get the decay schedule that was applied.
+	// When not set the amounts actually claimed are compared against the correct schedule.
+	BuggySchedule *ScheduleOverride `yaml:"buggy_schedule"`
+}
+
+// ScheduleOverride replaces the claims decay params of the genesis, zero values keep the genesis ones
+type ScheduleOverride struct {
+	AirdropStartTime   time.Time     `yaml:"airdrop_start_time"`
+	DurationUntilDecay time.Duration `yaml:"duration_until_decay"`
+	DurationOfDecay    time.Duration `yaml:"duration_of_decay"`
+}
+
+// EventRule captures the events of a type and stores them on a table
+type EventRule struct {
+	// Event is the event type to capture
+	Event string `yaml:"event"`
+	// Table is the table the event is stored on, either merged_event or claim_event
+	Table string `yaml:"table"`
+	// Columns maps each column of the table to the attribute key holding its value
+	Columns map[string]string `yaml:"columns"`
+	// Where lists the attribute values an event must have to be captured
+	Where map[string]string `yaml:"where"`
+}
+
+// DefaultEventRules captures every merge_claims_records and claim event.
+// Decission was made to collect all claim data within decay block range
+// instead of only merged / migrated accounts
+func DefaultEventRules() []EventRule {
+	return []EventRule{
+		{
+			Event: "merge_claims_records",
+			Table: "merged_event",
+			Columns: map[string]string{
+				"recipient":                 "recipient",
+				"claimed_coins":             "claimed_coins",
+				"fund_community_pool_coins": "fund_community_pool_coins",
+			},
+		},
+		{
+			Event: "claim",
+			Table: "claim_event",
+			Columns: map[string]string{
+				"sender":       "sender",
+				"amount":       "amount",
+				"claim_action": "action",
+			},
+		},
+	}
+}
+
+// Default returns the settings used when nothing else is configured
+func Default() Config {
+	return Config{
+		DBPath:                 "./accounts.db",
+		LogPath:                "./output.log",
+		DecayLogPath:           "./decay_loss_output.log",
+		GenesisPath:            "genesis.json",
+		BatchSize:              1000,
+		MaxWorkers:             5,
+		RPCEndpoints:           []string{query.DefaultClientURL},
+		RPCMaxAttempts:         5,
+		ClaimsDenom:            "aevmos",
+		DisplayPrecision:       6,
+		ReimbursementChunkSize: 500,
+		ReimbursementDust:      "0",
+		ReimbursementDir:       "./reimbursement",
+		EventRules:             DefaultEventRules(),
+	}
+}
+
+// Load returns the default settings overridden by the config file at path and the environment.
+// If path is empty DefaultPath is used when it exists.
+// The result is not validated so callers can apply further overrides before calling Validate.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path == "" {
+		if _, err := os.Stat(DefaultPath); err == nil {
+			path = DefaultPath
+		}
+	}
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("error reading config file: %v", err)
+		}
+		if err := yaml.Unmarshal(content, &cfg); err != nil {
+			return cfg, fmt.Errorf("error parsing config file %v: %v", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the settings with the DECAY_* environment variables
+func (c *Config) applyEnv() error {
+	stringVars := map[string]*string{
+		"DECAY_DB_PATH":            &c.DBPath,
+		"DECAY_LOG_PATH":           &c.LogPath,
+		"DECAY_DECAY_LOG_PATH":     &c.DecayLogPath,
+		"DECAY_GENESIS_PATH":       &c.GenesisPath,
+		"DECAY_BLOCKS_DIR":         &c.BlocksDir,
+		"DECAY_CLAIMS_DENOM":       &c.ClaimsDenom,
+		"DECAY_REIMBURSEMENT_FROM": &c.ReimbursementFrom,
+		"DECAY_REIMBURSEMENT_DUST": &c.ReimbursementDust,
+		"DECAY_REIMBURSEMENT_DIR":  &c.ReimbursementDir,
+	}
+	for key, field := range stringVars {
+		if value, ok := os.LookupEnv(key); ok {
+			*field = value
+		}
+	}
+
+	intVars := map[string]*int{
+		"DECAY_BATCH_SIZE":               &c.BatchSize,
+		"DECAY_MAX_WORKERS":              &c.MaxWorkers,
+		"DECAY_RPC_MAX_ATTEMPTS":         &c.RPCMaxAttempts,
+		"DECAY_DISPLAY_PRECISION":        &c.DisplayPrecision,
+		"DECAY_REIMBURSEMENT_CHUNK_SIZE": &c.ReimbursementChunkSize,
+	}
+	for key, field := range intVars {
+		if value, ok := os.LookupEnv(key); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%v is not a number: %q", key, value)
+			}
+			*field = parsed
+		}
+	}
+
+	if value, ok := os.LookupEnv("DECAY_RPC_ENDPOINTS"); ok {
+		c.RPCEndpoints = SplitList(value)
+	}
+	return nil
+}
+
+// Validate checks the settings are usable
+func (c Config) Validate() error {
+	if c.DBPath == "" {
+		return fmt.Errorf("db path can not be empty")
+	}
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("batch size must be positive, got %v", c.BatchSize)
+	}
+	if c.MaxWorkers <= 0 {
+		return fmt.Errorf("max workers must be positive, got %v", c.MaxWorkers)
+	}
+	if len(c.RPCEndpoints) == 0 {
+		return fmt.Errorf("at least one rpc endpoint is required")
+	}
+	if c.RPCMaxAttempts <= 0 {
+		return fmt.Errorf("rpc max attempts must be positive, got %v", c.RPCMaxAttempts)
+	}
+	if err := coin.ValidateDenom(c.ClaimsDenom); err != nil {
+		return fmt.Errorf("invalid claims denom: %v", err)
+	}
+	if c.DisplayPrecision < 0 || c.DisplayPrecision > coin.Precision {
+		return fmt.Errorf("display precision must be between 0 and %v, got %v", coin.Precision, c.DisplayPrecision)
+	}
+	if c.ReimbursementChunkSize <= 0 {
+		return fmt.Errorf("reimbursement chunk size must be positive, got %v", c.ReimbursementChunkSize)
+	}
+	if dust, ok := new(big.Int).SetString(c.ReimbursementDust, 10); !ok || dust.Sign() < 0 {
+		return fmt.Errorf("reimbursement dust must be a non negative integer, got %q", c.ReimbursementDust)
+	}
+	if c.ReimbursementFrom != "" {
+		if _, err := address.Prefix(c.ReimbursementFrom); err != nil {
+			return fmt.Errorf("invalid reimbursement from address: %v", err)
+		}
+	}
+	for i, rule := range c.EventRules {
+		if rule.Event == "" || rule.Table == "" {
+			return fmt.Errorf("event rule %v requires an event and a table", i)
+		}
+	}
+	return nil
+}
+
+// SplitList splits a comma separated list ignoring empty values
+func SplitList(value string) []string {
+	list := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,836 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// busyTimeout is how long a connection waits for the write lock held by another one
+const busyTimeout = 5 * time.Second
+
+// DB is the repository of the decay data stored on sqlite, or on postgres when opened
+// by OpenPostgres. Both backends share the same tables and queries.
+type DB struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// Open opens the sqlite database at path. The database uses WAL so reads do not block
+// the workers writing, and transactions take the write lock when they start waiting
+// up to busyTimeout for it instead of failing as soon as the database is locked.
+// Migrate must be called before using it.
+func Open(path string) (*DB, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	dsn := fmt.Sprintf("%v%v_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", path, sep, busyTimeout.Milliseconds())
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database connection: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening database %v: %v", path, err)
+	}
+	return &DB{db: db, dialect: sqliteDialect}, nil
+}
+
+// OpenReadOnly opens the existing sqlite database at path without writing to it, the
+// journal mode is left as it is and a missing database is an error instead of created
+func OpenReadOnly(path string) (*DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("error opening database %v: %v", path, err)
+	}
+	dsn := fmt.Sprintf("file:%v?mode=ro&_busy_timeout=%d", path, busyTimeout.Milliseconds())
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database connection: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening database %v: %v", path, err)
+	}
+	return &DB{db: db, dialect: sqliteDialect}, nil
+}
+
+// Close closes the database connections
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Migrate applies the pending migrations returning the ones applied
+func (d *DB) Migrate(claimsDenom string) ([]Migration, error) {
+	return d.dialect.migrations.migrate(d.db, claimsDenom)
+}
+
+// AppliedMigrations returns the migrations recorded on the schema_version table
+func (d *DB) AppliedMigrations() ([]AppliedMigration, error) {
+	return d.dialect.migrations.applied(d.db)
+}
+
+// Migrations returns every known migration of the schema of the backend
+func (d *DB) Migrations() []Migration {
+	return d.dialect.migrations.migrations
+}
+
+func (d *DB) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return d.db.QueryContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *DB) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return d.db.QueryRowContext(ctx, d.dialect.rebind(query), args...)
+}
+
+// withTx runs fn within a transaction, committing it when fn succeeds
+func (d *DB) withTx(ctx context.Context, fn func(tx *dialectTx) error) error {
+	// Nothing is stored once interrupted, the transaction is rolled back if it is interrupted midway
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := fn(&dialectTx{Tx: tx, dialect: d.dialect}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// EventBatch is the result of processing a batch of heights, stored at once by InsertEvents
+type EventBatch struct {
+	Claims     []ClaimEvent
+	Merged     []MergedEvent
+	BlockTimes []BlockTime
+	// Errors are the new failed heights and events
+	Errors []Error
+	// Retried are the errors queried again, flagged as resolved or not
+	Retried []Error
+	// Progress is the completed range of heights, if any
+	Progress *Progress
+}
+
+// InsertEvents upserts the events of the batch, caches its block times, records its errors
+// and marks its range as completed within a single transaction, so an interrupted batch leaves no rows behind
+func (d *DB) InsertEvents(ctx context.Context, batch EventBatch) error {
+	return d.withTx(ctx, func(tx *dialectTx) error {
+		if err := adoptEventsTx(ctx, tx, batch.Claims, batch.Merged); err != nil {
+			return err
+		}
+		if err := d.dialect.insertEvents(ctx, tx, batch.Claims, batch.Merged); err != nil {
+			return err
+		}
+		if err := insertBlockTimesTx(ctx, tx, batch.BlockTimes); err != nil {
+			return err
+		}
+		if err := updateErrorsTx(ctx, tx, batch.Retried); err != nil {
+			return err
+		}
+		if err := insertErrorsTx(ctx, tx, batch.Errors); err != nil {
+			return err
+		}
+		if batch.Progress == nil {
+			return nil
+		}
+
+		stmt, err := PrepareInsertProgressQuery(ctx, tx)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		return ExecContextProgress(ctx, stmt, *batch.Progress)
+	})
+}
+
+// RecordErrors stores failed heights and events on the error table
+func (d *DB) RecordErrors(ctx context.Context, errs []Error) error {
+	return d.withTx(ctx, func(tx *dialectTx) error {
+		return insertErrorsTx(ctx, tx, errs)
+	})
+}
+
+// adoptEventsTx gives the indexes of the collected events to the ones stored without them
+// with the same content, so the upsert replaces them instead of storing the events twice
+func adoptEventsTx(ctx context.Context, tx *dialectTx, claims []ClaimEvent, merged []MergedEvent) error {
+	var unindexed bool
+	err := tx.QueryRowContext(ctx, `select exists (select 1 from claim_event where tx_index is null)
+		or exists (select 1 from merged_event where tx_index is null)`).Scan(&unindexed)
+	if err != nil {
+		return fmt.Errorf("error reading events without indexes: %v", err)
+	}
+	if !unindexed {
+		return nil
+	}
+
+	adoptClaim, err := PrepareAdoptClaimEventQuery(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer adoptClaim.Close()
+	for _, e := range claims {
+		if _, err := ExecContextAdoptClaimEvent(ctx, adoptClaim, e); err != nil {
+			return err
+		}
+	}
+
+	adoptMerged, err := PrepareAdoptMergedEventQuery(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer adoptMerged.Close()
+	for _, e := range merged {
+		if _, err := ExecContextAdoptMergedEvent(ctx, adoptMerged, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertEventsTx upserts the claim and merged events one statement at a time
+func insertEventsTx(ctx context.Context, tx *dialectTx, claims []ClaimEvent, merged []MergedEvent) error {
+	stmt1, err := PrepareInsertMergeEventQuery(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer stmt1.Close()
+
+	stmt2, err := PrepareInsertClaimEventQuery(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer stmt2.Close()
+
+	for _, e := range merged {
+		if err := ExecContextMergedEvent(ctx, stmt1, e); err != nil {
+			return err
+		}
+	}
+	for _, e := range claims {
+		if err := ExecContextClaimEvent(ctx, stmt2, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertBlockTimesTx(ctx context.Context, tx *dialectTx, times []BlockTime) error {
+	if len(times) == 0 {
+		return nil
+	}
+	stmt, err := PrepareInsertBlockTimeQuery(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range times {
+		if err := ExecContextBlockTime(ctx, stmt, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertErrorsTx(ctx context.Context, tx *dialectTx, errs []Error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	stmt, err := PrepareInsertErrorQuery(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range errs {
+		if err := ExecContextError(ctx, stmt, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func updateErrorsTx(ctx context.Context, tx *dialectTx, errs []Error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	stmt, err := PrepareUpdateErrorQuery(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range errs {
+		if err := ExecContextErrorUpdate(ctx, stmt, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompletedRanges returns the block ranges processed on previous runs sorted by FromHeight
+func (d *DB) CompletedRanges(ctx context.Context) ([]Progress, error) {
+	rows, err := d.query(ctx, "select id, from_height, to_height from progress order by from_height")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completed := []Progress{}
+	for rows.Next() {
+		var p Progress
+		if err := rows.Scan(&p.ID, &p.FromHeight, &p.ToHeight); err != nil {
+			return nil, err
+		}
+		completed = append(completed, p)
+	}
+	return completed, rows.Err()
+}
+
+// UnresolvedErrors returns the errors that were not resolved yet ordered by height
+func (d *DB) UnresolvedErrors(ctx context.Context) ([]Error, error) {
+	return d.queryErrors(ctx, `select id, height, coalesce(event_type, ''), coalesce(tx_index, ''), coalesce(event_index, ''),
+		coalesce(message, ''), resolved, attempts from error where not resolved order by height, id`)
+}
+
+// UnresolvedErrorsWithinProgress returns the unresolved errors of the heights marked as completed on the progress table
+func (d *DB) UnresolvedErrorsWithinProgress(ctx context.Context) ([]Error, error) {
+	return d.queryErrors(ctx, `select e.id, e.height, coalesce(e.event_type, ''), coalesce(e.tx_index, ''), coalesce(e.event_index, ''),
+		coalesce(e.message, ''), e.resolved, e.attempts from error e
+		where not e.resolved and exists (select 1 from progress p where e.height between p.from_height and p.to_height)
+		order by e.height, e.id`)
+}
+
+func (d *DB) queryErrors(ctx context.Context, query string) ([]Error, error) {
+	rows, err := d.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	errs := []Error{}
+	for rows.Next() {
+		var e Error
+		if err := rows.Scan(&e.ID, &e.Height, &e.EventType, &e.TxIndex, &e.EventIndex, &e.Message, &e.Resolved, &e.Attempts); err != nil {
+			return nil, err
+		}
+		errs = append(errs, e)
+	}
+	return errs, rows.Err()
+}
+
+// BlockTime returns the cached time of the block at height and whether it was found
+func (d *DB) BlockTime(ctx context.Context, height int) (time.Time, bool, error) {
+	var t time.Time
+	err := d.queryRow(ctx, "select time from block_time where height = ?", height).Scan(&t)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("error reading block time: %v", err)
+	}
+	return t, true, nil
+}
+
+// HeightsWithoutBlockTime returns the heights of the claim and merged events stored without their block time
+func (d *DB) HeightsWithoutBlockTime(ctx context.Context) ([]int, error) {
+	rows, err := d.query(ctx, `select height from claim_event where block_time is null
+		union select height from merged_event where block_time is null order by height`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	heights := []int{}
+	for rows.Next() {
+		var height int
+		if err := rows.Scan(&height); err != nil {
+			return nil, err
+		}
+		heights = append(heights, height)
+	}
+	return heights, rows.Err()
+}
+
+// SetEventBlockTimes caches the block times and attaches them to the events stored without one
+func (d *DB) SetEventBlockTimes(ctx context.Context, times []BlockTime) error {
+	return d.withTx(ctx, func(tx *dialectTx) error {
+		if err := insertBlockTimesTx(ctx, tx, times); err != nil {
+			return err
+		}
+		for _, table := range []string{"claim_event", "merged_event"} {
+			stmt, err := tx.PrepareContext(ctx, "update "+table+" set block_time = ? where height = ? and block_time is null")
+			if err != nil {
+				return fmt.Errorf("error preparing statement for %v: %v", table, err)
+			}
+			defer stmt.Close()
+
+			for _, t := range times {
+				if _, err := stmt.ExecContext(ctx, t.Time.UTC(), t.Height); err != nil {
+					return fmt.Errorf("error updating block time of %v: %v", table, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// ForEachClaimEvent calls fn with every claim event ordered by id, along with the initial
+// claimable amount of the genesis claims record of its sender, empty when it has none.
+// Events stored without a block time have a zero BlockTime.
+func (d *DB) ForEachClaimEvent(ctx context.Context, fn func(event ClaimEvent, initialClaimable string) error) error {
+	rows, err := d.query(ctx, `select c.id, coalesce(c.sender, ''), c.height, coalesce(c.tx_index, -1), coalesce(c.event_index, -1),
+		coalesce(c.amount, ''), coalesce(c.denom, ''), coalesce(c.claim_action, ''), c.block_time, coalesce(r.initial_claimable_amount, '')
+		from claim_event c left join claims_record r on r.address = c.sender order by c.id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e ClaimEvent
+		var blockTime sql.NullTime
+		var initialClaimable string
+		if err := rows.Scan(&e.ID, &e.Sender, &e.Height, &e.TxIndex, &e.EventIndex, &e.Amount, &e.Denom, &e.Action, &blockTime, &initialClaimable); err != nil {
+			return err
+		}
+		e.BlockTime = blockTime.Time
+		if err := fn(e, initialClaimable); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ClaimEventsWithoutClaimsRecord returns the claim events whose sender has no genesis claims record
+func (d *DB) ClaimEventsWithoutClaimsRecord(ctx context.Context) ([]ClaimEvent, error) {
+	rows, err := d.query(ctx, `select c.id, coalesce(c.sender, ''), c.height, coalesce(c.claim_action, '') from claim_event c
+		left join claims_record r on r.address = c.sender where r.address is null order by c.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ClaimEvent{}
+	for rows.Next() {
+		var e ClaimEvent
+		if err := rows.Scan(&e.ID, &e.Sender, &e.Height, &e.Action); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// DoubleClaim is an action claimed more than once by the same account
+type DoubleClaim struct {
+	Sender string
+	Action string
+	Count  int
+	// Heights are the comma separated heights of the claims
+	Heights string
+}
+
+// DoubleClaims returns the actions claimed more than once by the same account
+func (d *DB) DoubleClaims(ctx context.Context) ([]DoubleClaim, error) {
+	rows, err := d.query(ctx, `select coalesce(sender, ''), coalesce(claim_action, ''), count(*), `+d.dialect.concatHeights+` from claim_event
+		group by sender, claim_action having count(*) > 1 order by sender, claim_action`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := []DoubleClaim{}
+	for rows.Next() {
+		var c DoubleClaim
+		if err := rows.Scan(&c.Sender, &c.Action, &c.Count, &c.Heights); err != nil {
+			return nil, err
+		}
+		claims = append(claims, c)
+	}
+	return claims, rows.Err()
+}
+
+// ClaimSendersWithoutDecayAmount returns the claim senders that have no decay amount
+func (d *DB) ClaimSendersWithoutDecayAmount(ctx context.Context) ([]string, error) {
+	rows, err := d.query(ctx, `select distinct c.sender from claim_event c
+		left join decay_amount d on d.sender = c.sender where d.sender is null order by c.sender`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	senders := []string{}
+	for rows.Next() {
+		var sender string
+		if err := rows.Scan(&sender); err != nil {
+			return nil, err
+		}
+		senders = append(senders, sender)
+	}
+	return senders, rows.Err()
+}
+
+// ForEachMergedEvent calls fn with every merged event ordered by id
+func (d *DB) ForEachMergedEvent(ctx context.Context, fn func(event MergedEvent) error) error {
+	rows, err := d.query(ctx, mergedEventQuery+" order by id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanMergedEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// MergedEventsWithoutSender returns the merged events whose IBC sender was not resolved yet ordered by id
+func (d *DB) MergedEventsWithoutSender(ctx context.Context) ([]MergedEvent, error) {
+	rows, err := d.query(ctx, mergedEventQuery+" where sender is null or sender = '' order by id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []MergedEvent{}
+	for rows.Next() {
+		e, err := scanMergedEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+const mergedEventQuery = `select id, coalesce(recipient, ''), coalesce(sender, ''), height, coalesce(tx_index, -1), coalesce(event_index, -1),
+	coalesce(claimed_coins, '0'), coalesce(claimed_denom, ''), coalesce(fund_community_pool_coins, '0'), coalesce(fund_community_pool_denom, ''),
+	block_time from merged_event`
+
+func scanMergedEvent(rows *sql.Rows) (MergedEvent, error) {
+	var e MergedEvent
+	var blockTime sql.NullTime
+	err := rows.Scan(&e.ID, &e.Recipient, &e.Sender, &e.Height, &e.TxIndex, &e.EventIndex,
+		&e.ClaimedCoins, &e.ClaimedDenom, &e.FundCommunityPool, &e.FundCommunityPoolDenom, &blockTime)
+	e.BlockTime = blockTime.Time
+	return e, err
+}
+
+// UpdateMergeSenders stores the resolved senders of the merged events, identified by ID,
+// and records the errors found within a single transaction
+func (d *DB) UpdateMergeSenders(ctx context.Context, events []MergedEvent, errs []Error) error {
+	return d.withTx(ctx, func(tx *dialectTx) error {
+		stmt, err := PrepareUpdateSenderMergeEventQuery(ctx, tx)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, e := range events {
+			if err := ExecContextMergeEventUpdate(ctx, stmt, e); err != nil {
+				return err
+			}
+		}
+		return insertErrorsTx(ctx, tx, errs)
+	})
+}
+
+// ClaimsWriter stores the claims of a genesis import
+type ClaimsWriter interface {
+	SetParams(params ClaimsParams) error
+	AddRecord(record ClaimsRecord) error
+}
+
+type claimsWriter struct {
+	ctx  context.Context
+	tx   *dialectTx
+	stmt *sql.Stmt
+}
+
+func (w claimsWriter) SetParams(params ClaimsParams) error {
+	return ExecContextClaimsParams(w.ctx, w.tx, params)
+}
+
+func (w claimsWriter) AddRecord(record ClaimsRecord) error {
+	return ExecContextClaimsRecord(w.ctx, w.stmt, record)
+}
+
+// ImportClaims replaces the claims records and params with the ones written by fn
+// within a single transaction, nothing is replaced when fn fails
+func (d *DB) ImportClaims(ctx context.Context, fn func(w ClaimsWriter) error) error {
+	return d.withTx(ctx, func(tx *dialectTx) error {
+		if _, err := tx.ExecContext(ctx, "delete from claims_record"); err != nil {
+			return fmt.Errorf("error deleting previous claims records: %v", err)
+		}
+
+		stmt, err := PrepareInsertClaimsRecordQuery(ctx, tx)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		return fn(claimsWriter{ctx: ctx, tx: tx, stmt: stmt})
+	})
+}
+
+// ClaimsParams returns the claims params stored by import-genesis, sql.ErrNoRows if there are none
+func (d *DB) ClaimsParams(ctx context.Context) (ClaimsParams, error) {
+	var params ClaimsParams
+	err := d.queryRow(ctx, "select enable_claims, airdrop_start_time, duration_until_decay, duration_of_decay, claims_denom from claims_params where id = 1").
+		Scan(&params.EnableClaims, &params.AirdropStartTime, &params.DurationUntilDecay, &params.DurationOfDecay, &params.ClaimsDenom)
+	params.AirdropStartTime = params.AirdropStartTime.UTC()
+	return params, err
+}
+
+// ClaimsRecord returns the genesis claims record of the address, sql.ErrNoRows if it has none
+func (d *DB) ClaimsRecord(ctx context.Context, address string) (ClaimsRecord, error) {
+	record := ClaimsRecord{Address: address}
+	err := d.queryRow(ctx, "select coalesce(actions_completed, ''), initial_claimable_amount from claims_record where address = ?", address).
+		Scan(&record.ActionsCompleted, &record.InitialClaimableAmount)
+	return record, err
+}
+
+// CountClaimsRecords returns the amount of genesis claims records stored
+func (d *DB) CountClaimsRecords(ctx context.Context) (int, error) {
+	var count int
+	err := d.queryRow(ctx, "select count(*) from claims_record").Scan(&count)
+	return count, err
+}
+
+// UpsertDecayAmounts stores the decay amounts within a single transaction,
+// replacing the ones stored for the same senders by previous runs
+func (d *DB) UpsertDecayAmounts(ctx context.Context, amounts []DecayAmount) error {
+	return d.withTx(ctx, func(tx *dialectTx) error {
+		stmt, err := PrepareUpsertDecayAmountQuery(ctx, tx)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, a := range amounts {
+			if err := ExecContextDecayAmount(ctx, stmt, a); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DecayAmounts returns the decay amount of every sender ordered by sender
+func (d *DB) DecayAmounts(ctx context.Context) ([]DecayAmount, error) {
+	rows, err := d.query(ctx, `select id, coalesce(sender, ''), coalesce(vote_action, ''), coalesce(ibc_action, ''), coalesce(delegate_action, ''),
+		coalesce(evm_action, ''), coalesce(merged_claimed, ''), coalesce(community_pool, ''), coalesce(total_claimed, ''), coalesce(total_lost, ''),
+		coalesce(initial_claimable_amount, ''), total_lost_evmos, coalesce(anomalies, '') from decay_amount order by sender`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	amounts := []DecayAmount{}
+	for rows.Next() {
+		var a DecayAmount
+		err := rows.Scan(&a.ID, &a.Sender, &a.VoteAction, &a.IBCAction, &a.DelegateAction, &a.EVMAction, &a.MergedClaimed, &a.CommunityPool,
+			&a.TotalClaimed, &a.TotalLost, &a.InitialClaimableAmount, &a.TotalLostEvmos, &a.Anomalies)
+		if err != nil {
+			return nil, err
+		}
+		amounts = append(amounts, a)
+	}
+	return amounts, rows.Err()
+}
+
+// ImportResult counts the rows stored by ImportEvents
+type ImportResult struct {
+	Claims     int
+	Merged     int
+	BlockTimes int
+}
+
+// ImportEvents stores the claims, merged events and block times of the batch that are not
+// stored yet within a single transaction. Events with a tx and event index are already stored
+// when a row has the same height and indexes, or when a row without indexes has the same
+// content, which takes their indexes. Events without indexes are told apart by their content
+// only, so identical ones, like several merges to an account in a block, are stored as many
+// times as the batch repeats them beyond the rows already stored with that content.
+func (d *DB) ImportEvents(ctx context.Context, batch EventBatch) (ImportResult, error) {
+	var result ImportResult
+	err := d.withTx(ctx, func(tx *dialectTx) error {
+		claims, err := newEventImporter(ctx, tx, "claim_event", claimEventContent, PrepareAdoptClaimEventQuery,
+			"insert into claim_event(sender, height, tx_index, event_index, amount, denom, claim_action, block_time) values(?,?,?,?,?,?,?,?)")
+		if err != nil {
+			return err
+		}
+		defer claims.close()
+		for _, e := range batch.Claims {
+			stored, err := claims.store(ctx, e.Height, e.TxIndex, e.EventIndex, claimContent(e), e.Sender, e.Height, nullIndex(e.TxIndex), nullIndex(e.EventIndex), e.Amount, e.Denom, e.Action, nullTime(e.BlockTime))
+			if err != nil {
+				return err
+			}
+			if stored {
+				result.Claims++
+			}
+		}
+
+		merged, err := newEventImporter(ctx, tx, "merged_event", mergedEventContent, PrepareAdoptMergedEventQuery,
+			`insert into merged_event(recipient, sender, height, tx_index, event_index, claimed_coins, claimed_denom,
+			fund_community_pool_coins, fund_community_pool_denom, block_time) values(?,?,?,?,?,?,?,?,?,?)`)
+		if err != nil {
+			return err
+		}
+		defer merged.close()
+		for _, e := range batch.Merged {
+			stored, err := merged.store(ctx, e.Height, e.TxIndex, e.EventIndex, mergedContent(e), e.Recipient, nullString(e.Sender), e.Height, nullIndex(e.TxIndex), nullIndex(e.EventIndex), e.ClaimedCoins, e.ClaimedDenom,
+				e.FundCommunityPool, e.FundCommunityPoolDenom, nullTime(e.BlockTime))
+			if err != nil {
+				return err
+			}
+			if stored {
+				result.Merged++
+			}
+		}
+
+		times, err := PrepareInsertBlockTimeQuery(ctx, tx)
+		if err != nil {
+			return err
+		}
+		defer times.Close()
+		for _, t := range batch.BlockTimes {
+			res, err := times.ExecContext(ctx, t.Height, t.Time.UTC())
+			if err != nil {
+				return fmt.Errorf("error inserting data into block_time: %v", err)
+			}
+			result.BlockTimes += rowsAffected(res)
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return result, nil
+}
+
+// eventImporter holds the statements storing the imported events of a table not stored yet
+type eventImporter struct {
+	table                           string
+	withIndexes, withContent, adopt *sql.Stmt
+	insert                          *sql.Stmt
+	// stored and seen count the rows without indexes of each content stored before the
+	// import and the ones found on the batch so far
+	stored, seen map[string]int
+}
+
+func newEventImporter(ctx context.Context, tx *dialectTx, table string, content []string,
+	prepareAdopt func(ctx context.Context, tx preparer) (*sql.Stmt, error), insert string) (*eventImporter, error) {
+	i := &eventImporter{table: table, stored: map[string]int{}, seen: map[string]int{}}
+	var err error
+	if i.withIndexes, err = tx.PrepareContext(ctx, "select count(*) from "+table+" where height = ? and tx_index = ? and event_index = ?"); err != nil {
+		return nil, fmt.Errorf("error preparing statement for %v: %v", table, err)
+	}
+	if i.withContent, err = tx.PrepareContext(ctx, "select count(*) from "+table+" where "+sameContent(content)); err != nil {
+		i.close()
+		return nil, fmt.Errorf("error preparing statement for %v: %v", table, err)
+	}
+	if i.adopt, err = prepareAdopt(ctx, tx); err != nil {
+		i.close()
+		return nil, err
+	}
+	if i.insert, err = tx.PrepareContext(ctx, insert); err != nil {
+		i.close()
+		return nil, fmt.Errorf("error preparing statement for %v: %v", table, err)
+	}
+	return i, nil
+}
+
+// store inserts the event with the values unless it is already stored, returning whether it was inserted
+func (i *eventImporter) store(ctx context.Context, height, txIndex, eventIndex int, content []interface{}, values ...interface{}) (bool, error) {
+	var count int
+	if txIndex == UnknownIndex {
+		key := fmt.Sprint(content...)
+		stored, ok := i.stored[key]
+		if !ok {
+			if err := i.withContent.QueryRowContext(ctx, content...).Scan(&stored); err != nil {
+				return false, fmt.Errorf("error reading %v: %v", i.table, err)
+			}
+			i.stored[key] = stored
+		}
+		i.seen[key]++
+		if i.seen[key] <= stored {
+			count = 1
+		}
+	} else {
+		if err := i.withIndexes.QueryRowContext(ctx, height, txIndex, eventIndex).Scan(&count); err != nil {
+			return false, fmt.Errorf("error reading %v: %v", i.table, err)
+		}
+		if count == 0 {
+			res, err := i.adopt.ExecContext(ctx, adoptArgs(height, txIndex, eventIndex, content)...)
+			if err != nil {
+				return false, fmt.Errorf("error updating indexes of %v: %v", i.table, err)
+			}
+			count = rowsAffected(res)
+		}
+	}
+	if count > 0 {
+		return false, nil
+	}
+	if _, err := i.insert.ExecContext(ctx, values...); err != nil {
+		return false, fmt.Errorf("error inserting data into %v: %v", i.table, err)
+	}
+	return true, nil
+}
+
+func (i *eventImporter) close() {
+	for _, stmt := range []*sql.Stmt{i.withIndexes, i.withContent, i.adopt, i.insert} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// nullIndex stores UnknownIndex as null
+func nullIndex(i int) interface{} {
+	if i == UnknownIndex {
+		return nil
+	}
+	return i
+}
+
+// nullTime stores the zero time as null
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// nullString stores the empty string as null
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func rowsAffected(res sql.Result) int {
+	n, _ := res.RowsAffected()
+	return int(n)
+}
@@ -0,0 +1,541 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facs95/decay-data/coin"
+	"golang.org/x/net/context"
+)
+
+// postgresEnv holds the connection url of the postgres database the tests also run on,
+// its tables are dropped before each test
+const postgresEnv = "DECAY_TEST_POSTGRES"
+
+// forEachDB runs the test on a migrated sqlite database and, when postgresEnv is set, on postgres
+func forEachDB(t *testing.T, test func(t *testing.T, d *DB)) {
+	t.Run("sqlite", func(t *testing.T) {
+		d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		if _, err := d.Migrate("aevmos"); err != nil {
+			t.Fatal(err)
+		}
+		test(t, d)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv(postgresEnv)
+		if dsn == "" {
+			t.Skipf("%v is not set", postgresEnv)
+		}
+		d, err := OpenPostgres(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		for _, table := range []string{"schema_version", "error", "merged_event", "claim_event", "decay_amount", "progress", "block_time", "claims_record", "claims_params"} {
+			if _, err := d.db.Exec("drop table if exists " + table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := d.Migrate("aevmos"); err != nil {
+			t.Fatal(err)
+		}
+		test(t, d)
+	})
+}
+
+func claimEvents(t *testing.T, d *DB) []ClaimEvent {
+	t.Helper()
+	events := []ClaimEvent{}
+	err := d.ForEachClaimEvent(context.Background(), func(e ClaimEvent, _ string) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func mergedEvents(t *testing.T, d *DB) []MergedEvent {
+	t.Helper()
+	events := []MergedEvent{}
+	err := d.ForEachMergedEvent(context.Background(), func(e MergedEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+var blockTime = time.Date(2022, 4, 27, 12, 0, 0, 0, time.UTC)
+
+func TestRebind(t *testing.T) {
+	query := "select * from claim_event where height = ? and sender = '?' and claim_action = ?"
+	if got := sqliteDialect.rebind(query); got != query {
+		t.Errorf("sqlite rebind = %q, want the query unchanged", got)
+	}
+	want := "select * from claim_event where height = $1 and sender = '?' and claim_action = $2"
+	if got := postgresDialect.rebind(query); got != want {
+		t.Errorf("postgres rebind = %q, want %q", got, want)
+	}
+}
+
+func TestInsertEvents(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		batch := EventBatch{
+			Claims: []ClaimEvent{
+				{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "100", Denom: "aevmos", Height: 10, TxIndex: 0, EventIndex: 2, BlockTime: blockTime},
+				{Sender: "evmos1b", Action: "ACTION_DELEGATE", Amount: "200", Denom: "aevmos", Height: 10, TxIndex: 1, EventIndex: 0, BlockTime: blockTime},
+			},
+			Merged: []MergedEvent{
+				{Recipient: "evmos1c", ClaimedCoins: "300", ClaimedDenom: "aevmos", FundCommunityPool: "5", FundCommunityPoolDenom: "aevmos", Height: 11, TxIndex: 0, EventIndex: 4, BlockTime: blockTime},
+			},
+			BlockTimes: []BlockTime{{Height: 10, Time: blockTime}, {Height: 11, Time: blockTime}},
+			Progress:   &Progress{FromHeight: 10, ToHeight: 11},
+		}
+		// Storing the same events twice leaves a single row for each of them
+		for i := 0; i < 2; i++ {
+			if err := d.InsertEvents(ctx, batch); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		claims := claimEvents(t, d)
+		if len(claims) != 2 {
+			t.Fatalf("got %v claim events, want 2", len(claims))
+		}
+		got := claims[0]
+		got.ID = 0
+		if want := batch.Claims[0]; got.Sender != want.Sender || got.Amount != want.Amount || got.TxIndex != want.TxIndex ||
+			got.EventIndex != want.EventIndex || !got.BlockTime.Equal(want.BlockTime) {
+			t.Errorf("got claim event %+v, want %+v", got, want)
+		}
+		merged := mergedEvents(t, d)
+		if len(merged) != 1 || merged[0].ClaimedCoins != "300" || merged[0].EventIndex != 4 {
+			t.Errorf("got merged events %+v", merged)
+		}
+
+		ranges, err := d.CompletedRanges(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ranges) != 2 || ranges[0].FromHeight != 10 || ranges[0].ToHeight != 11 {
+			t.Errorf("got completed ranges %+v", ranges)
+		}
+		stored, ok, err := d.BlockTime(ctx, 11)
+		if err != nil || !ok || !stored.Equal(blockTime) {
+			t.Errorf("BlockTime(11) = %v, %v, %v", stored, ok, err)
+		}
+		if _, ok, err := d.BlockTime(ctx, 12); err != nil || ok {
+			t.Errorf("BlockTime(12) = %v, %v, want not found", ok, err)
+		}
+	})
+}
+
+func TestInsertEventsCanceled(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		batch := EventBatch{Claims: []ClaimEvent{{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "1", Height: 1}}}
+		if err := d.InsertEvents(ctx, batch); err == nil {
+			t.Fatal("expected an error inserting an interrupted batch")
+		}
+		if claims := claimEvents(t, d); len(claims) != 0 {
+			t.Errorf("got %v claim events stored by an interrupted batch", len(claims))
+		}
+	})
+}
+
+func TestErrors(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		err := d.RecordErrors(ctx, []Error{
+			{Height: 5, EventType: "merge_claims_records", TxIndex: "0", EventIndex: "1", Message: "timeout"},
+			{Height: 50, Message: "timeout"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.InsertEvents(ctx, EventBatch{Progress: &Progress{FromHeight: 1, ToHeight: 10}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		unresolved, err := d.UnresolvedErrors(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(unresolved) != 2 || unresolved[0].Height != 5 || unresolved[0].EventType != "merge_claims_records" || unresolved[0].TxIndex != "0" {
+			t.Fatalf("got unresolved errors %+v", unresolved)
+		}
+		within, err := d.UnresolvedErrorsWithinProgress(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(within) != 1 || within[0].Height != 5 {
+			t.Fatalf("got unresolved errors within progress %+v", within)
+		}
+
+		retried := within[0]
+		retried.Resolved = true
+		if err := d.InsertEvents(ctx, EventBatch{Retried: []Error{retried}}); err != nil {
+			t.Fatal(err)
+		}
+		unresolved, err = d.UnresolvedErrors(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(unresolved) != 1 || unresolved[0].Height != 50 {
+			t.Errorf("got unresolved errors %+v after resolving height 5", unresolved)
+		}
+	})
+}
+
+func TestSetEventBlockTimes(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		_, err := d.ImportEvents(ctx, EventBatch{
+			Claims: []ClaimEvent{{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "1", Denom: "aevmos", Height: 7, TxIndex: UnknownIndex, EventIndex: UnknownIndex}},
+			Merged: []MergedEvent{{Recipient: "evmos1b", ClaimedCoins: "1", FundCommunityPool: "0", Height: 8, TxIndex: UnknownIndex, EventIndex: UnknownIndex}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		heights, err := d.HeightsWithoutBlockTime(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(heights) != 2 || heights[0] != 7 || heights[1] != 8 {
+			t.Fatalf("got heights without block time %v, want [7 8]", heights)
+		}
+
+		if err := d.SetEventBlockTimes(ctx, []BlockTime{{Height: 7, Time: blockTime}, {Height: 8, Time: blockTime}}); err != nil {
+			t.Fatal(err)
+		}
+		heights, err = d.HeightsWithoutBlockTime(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(heights) != 0 {
+			t.Errorf("got heights without block time %v after setting them", heights)
+		}
+		if claims := claimEvents(t, d); !claims[0].BlockTime.Equal(blockTime) || claims[0].TxIndex != UnknownIndex {
+			t.Errorf("got claim event %+v", claims[0])
+		}
+	})
+}
+
+func TestImportClaims(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		params := ClaimsParams{EnableClaims: true, AirdropStartTime: blockTime, DurationUntilDecay: "2629800s", DurationOfDecay: "5259600s", ClaimsDenom: "aevmos"}
+		write := func(records ...ClaimsRecord) error {
+			return d.ImportClaims(ctx, func(w ClaimsWriter) error {
+				if err := w.SetParams(params); err != nil {
+					return err
+				}
+				for _, r := range records {
+					if err := w.AddRecord(r); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+		if err := write(ClaimsRecord{Address: "evmos1a", ActionsCompleted: "[]", InitialClaimableAmount: "100"}, ClaimsRecord{Address: "evmos1b", InitialClaimableAmount: "200"}); err != nil {
+			t.Fatal(err)
+		}
+		// A new import replaces the previous records
+		if err := write(ClaimsRecord{Address: "evmos1a", ActionsCompleted: "[true]", InitialClaimableAmount: "400"}); err != nil {
+			t.Fatal(err)
+		}
+
+		count, err := d.CountClaimsRecords(ctx)
+		if err != nil || count != 1 {
+			t.Fatalf("CountClaimsRecords = %v, %v, want 1", count, err)
+		}
+		record, err := d.ClaimsRecord(ctx, "evmos1a")
+		if err != nil || record.InitialClaimableAmount != "400" || record.ActionsCompleted != "[true]" {
+			t.Errorf("ClaimsRecord = %+v, %v", record, err)
+		}
+		stored, err := d.ClaimsParams(ctx)
+		if err != nil || stored != params {
+			t.Errorf("ClaimsParams = %+v, %v, want %+v", stored, err, params)
+		}
+
+		err = d.InsertEvents(ctx, EventBatch{Claims: []ClaimEvent{
+			{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "1", Height: 3, TxIndex: 0, EventIndex: 0},
+			{Sender: "evmos1b", Action: "ACTION_VOTE", Amount: "1", Height: 3, TxIndex: 0, EventIndex: 1},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		missing, err := d.ClaimEventsWithoutClaimsRecord(ctx)
+		if err != nil || len(missing) != 1 || missing[0].Sender != "evmos1b" {
+			t.Errorf("ClaimEventsWithoutClaimsRecord = %+v, %v", missing, err)
+		}
+	})
+}
+
+func TestDoubleClaims(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		err := d.InsertEvents(ctx, EventBatch{Claims: []ClaimEvent{
+			{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "1", Height: 3, TxIndex: 0, EventIndex: 0},
+			{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "1", Height: 9, TxIndex: 0, EventIndex: 0},
+			{Sender: "evmos1a", Action: "ACTION_DELEGATE", Amount: "1", Height: 9, TxIndex: 0, EventIndex: 1},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := d.DoubleClaims(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(claims) != 1 || claims[0].Action != "ACTION_VOTE" || claims[0].Count != 2 || claims[0].Heights != "3,9" {
+			t.Errorf("got double claims %+v", claims)
+		}
+	})
+}
+
+func TestUpdateMergeSenders(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		err := d.InsertEvents(ctx, EventBatch{Merged: []MergedEvent{
+			{Recipient: "evmos1a", ClaimedCoins: "1", FundCommunityPool: "0", Height: 3, TxIndex: 0, EventIndex: 0},
+			{Recipient: "evmos1b", ClaimedCoins: "1", FundCommunityPool: "0", Height: 3, TxIndex: 0, EventIndex: 1},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending, err := d.MergedEventsWithoutSender(ctx)
+		if err != nil || len(pending) != 2 {
+			t.Fatalf("MergedEventsWithoutSender = %+v, %v", pending, err)
+		}
+		pending[0].Sender = "osmo1a"
+		if err := d.UpdateMergeSenders(ctx, pending[:1], []Error{{Height: 3, Message: "no sender"}}); err != nil {
+			t.Fatal(err)
+		}
+		pending, err = d.MergedEventsWithoutSender(ctx)
+		if err != nil || len(pending) != 1 || pending[0].Recipient != "evmos1b" {
+			t.Errorf("MergedEventsWithoutSender = %+v, %v", pending, err)
+		}
+		if errs, err := d.UnresolvedErrors(ctx); err != nil || len(errs) != 1 {
+			t.Errorf("UnresolvedErrors = %+v, %v", errs, err)
+		}
+	})
+}
+
+func TestDecayAmounts(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		lost, err := coin.ParseDec("1.000000000000000001")
+		if err != nil {
+			t.Fatal(err)
+		}
+		amount := DecayAmount{Sender: "evmos1a", VoteAction: "1", TotalLost: "5", TotalLostEvmos: coin.ZeroDec()}
+		if err := d.UpsertDecayAmounts(ctx, []DecayAmount{amount}); err != nil {
+			t.Fatal(err)
+		}
+		// A new calculation replaces the previous one of the sender
+		amount.TotalLostEvmos = lost
+		amount.Anomalies = "over_claimed"
+		if err := d.UpsertDecayAmounts(ctx, []DecayAmount{amount}); err != nil {
+			t.Fatal(err)
+		}
+
+		amounts, err := d.DecayAmounts(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(amounts) != 1 || amounts[0].TotalLostEvmos.Cmp(lost) != 0 || amounts[0].Anomalies != "over_claimed" {
+			t.Errorf("got decay amounts %+v", amounts)
+		}
+		err = d.InsertEvents(ctx, EventBatch{Claims: []ClaimEvent{
+			{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "1", Height: 3, TxIndex: 0, EventIndex: 0},
+			{Sender: "evmos1b", Action: "ACTION_VOTE", Amount: "1", Height: 3, TxIndex: 0, EventIndex: 1},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		senders, err := d.ClaimSendersWithoutDecayAmount(ctx)
+		if err != nil || len(senders) != 1 || senders[0] != "evmos1b" {
+			t.Errorf("ClaimSendersWithoutDecayAmount = %v, %v", senders, err)
+		}
+	})
+}
+
+func TestInsertEventsAdoptsUnindexed(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		claim := ClaimEvent{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "100", Denom: "aevmos", Height: 10, TxIndex: UnknownIndex, EventIndex: UnknownIndex}
+		merge := MergedEvent{Recipient: "evmos1b", ClaimedCoins: "300", ClaimedDenom: "aevmos", FundCommunityPool: "5", FundCommunityPoolDenom: "aevmos",
+			Height: 11, TxIndex: UnknownIndex, EventIndex: UnknownIndex}
+		if _, err := d.ImportEvents(ctx, EventBatch{Claims: []ClaimEvent{claim}, Merged: []MergedEvent{merge}}); err != nil {
+			t.Fatal(err)
+		}
+
+		claim.TxIndex, claim.EventIndex = 2, 3
+		merge.TxIndex, merge.EventIndex = 4, 5
+		// A claim of another amount is a different event
+		other := ClaimEvent{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "7", Denom: "aevmos", Height: 10, TxIndex: 2, EventIndex: 4}
+		batch := EventBatch{Claims: []ClaimEvent{claim, other}, Merged: []MergedEvent{merge}}
+		for i := 0; i < 2; i++ {
+			if err := d.InsertEvents(ctx, batch); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		claims := claimEvents(t, d)
+		if len(claims) != 2 || claims[0].TxIndex != 2 || claims[0].EventIndex != 3 || claims[1].Amount != "7" {
+			t.Errorf("got claim events %+v, want the stored one with indexes and the new one", claims)
+		}
+		merged := mergedEvents(t, d)
+		if len(merged) != 1 || merged[0].TxIndex != 4 || merged[0].EventIndex != 5 {
+			t.Errorf("got merged events %+v, want the stored one with indexes", merged)
+		}
+	})
+}
+
+func TestDropDuplicatedUnindexedEvents(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		inserts := []string{
+			// a legacy claim collected again, two identical legacy ones and a legacy one of another amount
+			"insert into claim_event(sender, height, amount, denom, claim_action) values('evmos1a', 10, '100', 'aevmos', 'ACTION_VOTE')",
+			"insert into claim_event(sender, height, tx_index, event_index, amount, denom, claim_action) values('evmos1a', 10, 0, 1, '100', 'aevmos', 'ACTION_VOTE')",
+			"insert into claim_event(sender, height, amount, denom, claim_action) values('evmos1b', 10, '100', 'aevmos', 'ACTION_VOTE')",
+			"insert into claim_event(sender, height, amount, denom, claim_action) values('evmos1b', 10, '100', 'aevmos', 'ACTION_VOTE')",
+			"insert into claim_event(sender, height, amount, denom, claim_action) values('evmos1b', 10, '50', 'aevmos', 'ACTION_VOTE')",
+			// three identical legacy merges, only the first collected again
+			"insert into merged_event(recipient, sender, height, claimed_coins, fund_community_pool_coins) values('evmos1c', 'osmo1c', 11, '300', '5')",
+			"insert into merged_event(recipient, sender, height, claimed_coins, fund_community_pool_coins) values('evmos1c', 'osmo1d', 11, '300', '5')",
+			"insert into merged_event(recipient, sender, height, claimed_coins, fund_community_pool_coins) values('evmos1c', 'osmo1e', 11, '300', '5')",
+			"insert into merged_event(recipient, height, tx_index, event_index, claimed_coins, fund_community_pool_coins) values('evmos1c', 11, 0, 0, '300', '5')",
+		}
+		for _, insert := range inserts {
+			if _, err := d.db.Exec(insert); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tx, err := d.db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback() //nolint:errcheck
+		if err := dropDuplicatedUnindexedEvents(tx, "aevmos"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		claims := claimEvents(t, d)
+		if len(claims) != 4 || claims[0].TxIndex != 0 || claims[0].EventIndex != 1 ||
+			claims[1].Sender != "evmos1b" || claims[2].Sender != "evmos1b" || claims[3].Amount != "50" {
+			t.Errorf("got claim events %+v", claims)
+		}
+		merged := mergedEvents(t, d)
+		if len(merged) != 3 || merged[0].Sender != "osmo1d" || merged[1].Sender != "osmo1e" || merged[2].TxIndex != 0 || merged[2].Sender != "osmo1c" {
+			t.Errorf("got merged events %+v", merged)
+		}
+	})
+}
+
+func TestImportEvents(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		collected := ClaimEvent{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "100", Denom: "aevmos", Height: 10, TxIndex: 0, EventIndex: 0}
+		if err := d.InsertEvents(ctx, EventBatch{Claims: []ClaimEvent{collected}}); err != nil {
+			t.Fatal(err)
+		}
+
+		unindexed := func(e ClaimEvent) ClaimEvent {
+			e.TxIndex, e.EventIndex = UnknownIndex, UnknownIndex
+			return e
+		}
+		second := ClaimEvent{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "50", Denom: "aevmos", Height: 10, TxIndex: 1, EventIndex: 0}
+		other := ClaimEvent{Sender: "evmos1b", Action: "ACTION_EVM", Amount: "10", Denom: "aevmos", Height: 12, TxIndex: UnknownIndex, EventIndex: UnknownIndex}
+		indexedOther := other
+		indexedOther.TxIndex, indexedOther.EventIndex = 3, 1
+		merge := MergedEvent{Recipient: "evmos1c", ClaimedCoins: "300", FundCommunityPool: "5", Height: 11, TxIndex: UnknownIndex, EventIndex: UnknownIndex}
+
+		batch := EventBatch{
+			Claims: []ClaimEvent{
+				collected,            // stored with the same indexes
+				unindexed(collected), // stored with the same content
+				second,               // a second claim of the sender on the block
+				other,                // new
+				other,                // an identical claim, stored too
+				indexedOther,         // gives its indexes to the one stored without them
+			},
+			Merged:     []MergedEvent{merge, merge},
+			BlockTimes: []BlockTime{{Height: 10, Time: blockTime}, {Height: 10, Time: blockTime}},
+		}
+		result, err := d.ImportEvents(ctx, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (ImportResult{Claims: 3, Merged: 2, BlockTimes: 1}); result != want {
+			t.Errorf("got import result %+v, want %+v", result, want)
+		}
+
+		claims := claimEvents(t, d)
+		if len(claims) != 4 || claims[1].Amount != "50" || claims[2].Sender != "evmos1b" || claims[2].TxIndex != 3 || claims[2].EventIndex != 1 ||
+			claims[3].Sender != "evmos1b" || claims[3].TxIndex != UnknownIndex {
+			t.Errorf("got claim events %+v", claims)
+		}
+
+		// Importing the same batch again stores nothing
+		result, err = d.ImportEvents(ctx, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != (ImportResult{}) {
+			t.Errorf("got import result %+v importing the batch again", result)
+		}
+	})
+}
+
+func TestImportEventsIdenticalUnindexed(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		// several merges to an account in a block can only be told apart by their number
+		merge := MergedEvent{Recipient: "evmos1a", ClaimedCoins: "300", FundCommunityPool: "5", Height: 274509, TxIndex: UnknownIndex, EventIndex: UnknownIndex}
+		result, err := d.ImportEvents(ctx, EventBatch{Merged: []MergedEvent{merge, merge, merge}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Merged != 3 || len(mergedEvents(t, d)) != 3 {
+			t.Errorf("got import result %+v, want the 3 merges stored", result)
+		}
+
+		// Importing them again stores nothing, a fourth one is stored
+		for _, tc := range []struct {
+			copies, want int
+		}{{3, 0}, {2, 0}, {4, 1}} {
+			batch := EventBatch{}
+			for i := 0; i < tc.copies; i++ {
+				batch.Merged = append(batch.Merged, merge)
+			}
+			result, err := d.ImportEvents(ctx, batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Merged != tc.want {
+				t.Errorf("got %v merges stored importing %v copies, want %v", result.Merged, tc.copies, tc.want)
+			}
+		}
+		if merged := mergedEvents(t, d); len(merged) != 4 {
+			t.Errorf("got %v merged events, want 4", len(merged))
+		}
+	})
+}
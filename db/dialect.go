@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// dialect is what differs between the sqlite and postgres backends, the queries are
+// shared and written with ? placeholders, which are rebound to $1, $2... on postgres
+type dialect struct {
+	// numbered is whether the placeholders are numbered instead of question marks
+	numbered   bool
+	migrations migrationSet
+	// concatHeights aggregates the heights of a group as comma separated text
+	concatHeights string
+	// insertEvents upserts the collected claim and merged events
+	insertEvents func(ctx context.Context, tx *dialectTx, claims []ClaimEvent, merged []MergedEvent) error
+	// readOnly runs fn on a connection that can not modify the database
+	readOnly func(ctx context.Context, db *sql.DB, fn func(q rowsQueryer) error) error
+}
+
+var sqliteDialect = dialect{
+	migrations:    sqliteMigrations,
+	concatHeights: "group_concat(height)",
+	insertEvents:  insertEventsTx,
+	readOnly:      sqliteReadOnly,
+}
+
+var postgresDialect = dialect{
+	numbered:      true,
+	migrations:    postgresMigrations,
+	concatHeights: "string_agg(height::text, ',' order by height)",
+	insertEvents:  copyEventsTx,
+	readOnly:      postgresReadOnly,
+}
+
+// rebind replaces the ? placeholders of the query by numbered ones when the dialect
+// uses them, question marks within quoted strings are kept
+func (d dialect) rebind(query string) string {
+	if !d.numbered || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dialectTx is a transaction rebinding the placeholders of its queries for the backend
+type dialectTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (tx *dialectTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return tx.Tx.PrepareContext(ctx, tx.dialect.rebind(query))
+}
+
+func (tx *dialectTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.dialect.rebind(query), args...)
+}
+
+func (tx *dialectTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.dialect.rebind(query), args...)
+}
+
+func (tx *dialectTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.dialect.rebind(query), args...)
+}
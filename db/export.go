@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Export selects the rows of a table, or of a query, to export
+type Export struct {
+	// Table is the table to export, ignored when Query is set
+	Table string
+	// Query is a select statement to export instead of a table
+	Query string
+	// Columns are the columns exported, all of them when empty
+	Columns []string
+	// FromHeight and ToHeight keep the rows within both heights, both included, when not zero
+	FromHeight int
+	ToHeight   int
+	// OrderBy are the columns the rows are sorted by before the key of the table
+	OrderBy []string
+}
+
+// tableKeys are the columns identifying the rows of each table, appended to the
+// order of the export so its rows always come in the same order
+var tableKeys = map[string][]string{
+	"error":         {"id"},
+	"merged_event":  {"id"},
+	"claim_event":   {"id"},
+	"decay_amount":  {"id"},
+	"progress":      {"id"},
+	"block_time":    {"height"},
+	"claims_record": {"address"},
+	"claims_params": {"id"},
+}
+
+// exportQuery returns the query selecting the rows of the export, validating the columns
+// against the ones of the table or query. The query is wrapped as a subquery when filtered,
+// its rows are sorted by every exported column unless OrderBy is set.
+func exportQuery(ctx context.Context, db rowsQueryer, e Export) (string, error) {
+	from := ""
+	var keys []string
+	if e.Query != "" {
+		from = fmt.Sprintf("(%v) q", strings.TrimSuffix(strings.TrimSpace(e.Query), ";"))
+	} else {
+		var ok bool
+		if keys, ok = tableKeys[e.Table]; !ok {
+			return "", fmt.Errorf("unknown table %q", e.Table)
+		}
+		from = e.Table
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("select * from %v where 1 = 0", from))
+	if err != nil {
+		return "", fmt.Errorf("error reading the columns of %v: %v", from, err)
+	}
+	available, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return "", err
+	}
+	known := make(map[string]bool)
+	for _, c := range available {
+		known[c] = true
+	}
+	check := func(columns []string) error {
+		for _, c := range columns {
+			if !known[c] {
+				return fmt.Errorf("unknown column %q, expected one of %v", c, strings.Join(available, ", "))
+			}
+		}
+		return nil
+	}
+	if err := check(e.Columns); err != nil {
+		return "", err
+	}
+	if err := check(e.OrderBy); err != nil {
+		return "", err
+	}
+
+	columns := e.Columns
+	if len(columns) == 0 {
+		columns = available
+	}
+	query := fmt.Sprintf("select %v from %v", quoteColumns(columns), from)
+
+	conditions := []string{}
+	if e.FromHeight != 0 || e.ToHeight != 0 {
+		if !known["height"] {
+			return "", fmt.Errorf("%v has no height column to filter by", from)
+		}
+		if e.FromHeight != 0 {
+			conditions = append(conditions, fmt.Sprintf("height >= %d", e.FromHeight))
+		}
+		if e.ToHeight != 0 {
+			conditions = append(conditions, fmt.Sprintf("height <= %d", e.ToHeight))
+		}
+	}
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+
+	order := append([]string{}, e.OrderBy...)
+	if e.Query != "" && len(order) == 0 {
+		order = columns
+	}
+	for _, k := range keys {
+		if !contains(order, k) {
+			order = append(order, k)
+		}
+	}
+	return query + " order by " + quoteColumns(order), nil
+}
+
+// quoteColumns returns the comma separated quoted column names
+func quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = `"` + strings.ReplaceAll(c, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// rowsQueryer is satisfied by *sql.Conn and *sql.Tx
+type rowsQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Export calls fn with the rows of the export. The query runs on a connection that can not
+// modify the database, so a query given by the user can only read it.
+func (d *DB) Export(ctx context.Context, e Export, fn func(rows *sql.Rows) error) error {
+	return d.dialect.readOnly(ctx, d.db, func(q rowsQueryer) error {
+		query, err := exportQuery(ctx, q, e)
+		if err != nil {
+			return err
+		}
+		rows, err := q.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		return fn(rows)
+	})
+}
+
+// sqliteReadOnly runs fn on a connection with the query_only pragma set, which is reset
+// before the connection goes back to the pool. No transaction is started as they take
+// the write lock.
+func sqliteReadOnly(ctx context.Context, db *sql.DB, fn func(q rowsQueryer) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "pragma query_only = 1"); err != nil {
+		return fmt.Errorf("error setting the connection read only: %v", err)
+	}
+	defer conn.ExecContext(context.Background(), "pragma query_only = 0") //nolint:errcheck
+	return fn(conn)
+}
+
+// postgresReadOnly runs fn within a read only transaction, which is rolled back afterwards
+func postgresReadOnly(ctx context.Context, db *sql.DB, fn func(q rowsQueryer) error) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	return fn(tx)
+}
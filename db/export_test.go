@@ -0,0 +1,118 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// exported returns the rows of the export as strings
+func exported(t *testing.T, d *DB, e Export) ([][]string, error) {
+	t.Helper()
+	result := [][]string{}
+	err := d.Export(context.Background(), e, func(rows *sql.Rows) error {
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			values := make([]sql.NullString, len(columns))
+			ptrs := make([]interface{}, len(columns))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				return err
+			}
+			row := make([]string, len(values))
+			for i, v := range values {
+				row[i] = v.String
+			}
+			result = append(result, row)
+		}
+		return rows.Err()
+	})
+	return result, err
+}
+
+func TestExport(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		err := d.InsertEvents(context.Background(), EventBatch{Claims: []ClaimEvent{
+			{Sender: "evmos1b", Action: "ACTION_VOTE", Amount: "2", Denom: "aevmos", Height: 20, TxIndex: 0, EventIndex: 0},
+			{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "1", Denom: "aevmos", Height: 10, TxIndex: 0, EventIndex: 0},
+			{Sender: "evmos1c", Action: "ACTION_EVM", Amount: "3", Denom: "aevmos", Height: 30, TxIndex: 0, EventIndex: 0},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := exported(t, d, Export{Table: "claim_event", Columns: []string{"sender", "height"}, OrderBy: []string{"height"}, FromHeight: 15})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 2 || rows[0][0] != "evmos1b" || rows[1][0] != "evmos1c" {
+			t.Errorf("got rows %v", rows)
+		}
+
+		rows, err = exported(t, d, Export{Query: "select claim_action, count(*) as claims from claim_event group by claim_action;"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 2 || rows[0][0] != "ACTION_EVM" || rows[1][1] != "2" {
+			t.Errorf("got rows %v", rows)
+		}
+
+		for _, e := range []Export{
+			{Table: "accounts"},
+			{Table: "claim_event", Columns: []string{"address"}},
+			{Table: "claims_record", FromHeight: 1},
+		} {
+			if _, err := exported(t, d, e); err == nil {
+				t.Errorf("expected an error exporting %+v", e)
+			}
+		}
+	})
+}
+
+func TestExportIsReadOnly(t *testing.T) {
+	forEachDB(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		if err := d.InsertEvents(ctx, EventBatch{Progress: &Progress{FromHeight: 1, ToHeight: 10}}); err != nil {
+			t.Fatal(err)
+		}
+		// The query closes the subquery it is wrapped in to run a statement of its own
+		queries := []string{
+			"select 1 as x) q; delete from progress; select * from (select 1 as x",
+			"delete from progress returning *",
+		}
+		for _, query := range queries {
+			exported(t, d, Export{Query: query}) //nolint:errcheck
+		}
+		// Statements run on the export connection can not write either
+		err := d.dialect.readOnly(ctx, d.db, func(q rowsQueryer) error {
+			rows, err := q.QueryContext(ctx, "delete from progress returning *")
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+			}
+			return rows.Err()
+		})
+		if err == nil {
+			t.Error("expected an error deleting on a read only connection")
+		}
+		ranges, err := d.CompletedRanges(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ranges) != 1 {
+			t.Errorf("got %v completed ranges after exporting, want 1", len(ranges))
+		}
+		// The connection can write again once the export is done
+		if err := d.InsertEvents(ctx, EventBatch{Progress: &Progress{FromHeight: 11, ToHeight: 20}}); err != nil {
+			t.Errorf("error writing after an export: %v", err)
+		}
+	})
+}
@@ -0,0 +1,472 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/facs95/decay-data/coin"
+)
+
+// Migration is a versioned change of the database schema. Migrations are applied in
+// order, each one on its own transaction, and recorded on the schema_version table.
+type Migration struct {
+	Version     int
+	Description string
+	up          func(tx *sql.Tx, claimsDenom string) error
+}
+
+// Migrations is the ordered list of migrations, new migrations must be appended
+// with the next version and existing ones must not be changed
+var Migrations = []Migration{
+	{1, "create tables", createTables},
+	{2, "rebuild legacy error, merged_event and claim_event tables", rebuildLegacyTables},
+	{3, "add columns missing on databases of previous versions", addMissingColumns},
+	{4, "split legacy coin amounts into amount and denom", splitLegacyCoins},
+	{5, "store total_lost_evmos as an exact decimal", recalculateTotalLostEvmos},
+	{6, "keep a single decay amount per sender", uniqueDecayAmountSender},
+	{7, "drop events without indexes collected again with them", dropDuplicatedUnindexedEvents},
+}
+
+// AppliedMigration is a row of the schema_version table
+type AppliedMigration struct {
+	Version     int
+	Description string
+	AppliedAt   time.Time
+}
+
+// createSchemaVersionTable is valid on both sqlite and postgres
+const createSchemaVersionTable = `
+	   create table if not exists schema_version (
+	    version integer not null primary key,
+        description text not null,
+        applied_at timestamp not null default current_timestamp
+	);`
+
+// migrationSet is the migrations of a backend along with the queries handling its schema_version table
+type migrationSet struct {
+	migrations []Migration
+	// recordVersion inserts the version, description and time a migration was applied
+	recordVersion string
+	// versionTableExists counts the schema_version tables
+	versionTableExists string
+}
+
+var sqliteMigrations = migrationSet{
+	migrations:         Migrations,
+	recordVersion:      "insert into schema_version(version, description, applied_at) values(?,?,?)",
+	versionTableExists: "select count(*) from sqlite_master where type = 'table' and name = 'schema_version'",
+}
+
+// Migrate applies the pending migrations returning the ones applied.
+// claimsDenom is used to split the raw coins stored by old versions.
+func Migrate(db *sql.DB, claimsDenom string) ([]Migration, error) {
+	return sqliteMigrations.migrate(db, claimsDenom)
+}
+
+// SchemaVersion returns the latest migration applied to the database, zero if none
+func SchemaVersion(db *sql.DB) (int, error) {
+	return sqliteMigrations.schemaVersion(db)
+}
+
+// AppliedMigrations returns the rows of the schema_version table ordered by version
+// without modifying the database
+func AppliedMigrations(db *sql.DB) ([]AppliedMigration, error) {
+	return sqliteMigrations.applied(db)
+}
+
+func (s migrationSet) migrate(db *sql.DB, claimsDenom string) ([]Migration, error) {
+	if _, err := db.Exec(createSchemaVersionTable); err != nil {
+		return nil, fmt.Errorf("error creating schema_version table: %v", err)
+	}
+	version, err := s.schemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if latest := s.migrations[len(s.migrations)-1].Version; version > latest {
+		return nil, fmt.Errorf("database schema version %v is newer than the latest known version %v", version, latest)
+	}
+
+	applied := []Migration{}
+	for _, m := range s.migrations {
+		if m.Version <= version {
+			continue
+		}
+		if err := s.apply(db, m, claimsDenom); err != nil {
+			return applied, fmt.Errorf("error applying migration %v (%v): %v", m.Version, m.Description, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func (s migrationSet) apply(db *sql.DB, m Migration, claimsDenom string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := m.up(tx, claimsDenom); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.recordVersion, m.Version, m.Description, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s migrationSet) schemaVersion(db *sql.DB) (int, error) {
+	applied, err := s.applied(db)
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+func (s migrationSet) applied(db *sql.DB) ([]AppliedMigration, error) {
+	var count int
+	if err := db.QueryRow(s.versionTableExists).Scan(&count); err != nil || count == 0 {
+		return nil, err
+	}
+
+	rows, err := db.Query("select version, description, applied_at from schema_version order by version")
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_version: %v", err)
+	}
+	defer rows.Close()
+	applied := []AppliedMigration{}
+	for rows.Next() {
+		var m AppliedMigration
+		if err := rows.Scan(&m.Version, &m.Description, &m.AppliedAt); err != nil {
+			return nil, fmt.Errorf("error reading schema_version: %v", err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, rows.Err()
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// tableColumns returns the column names of the table
+func tableColumns(q queryer, name string) (map[string]bool, error) {
+	rows, err := q.Query(fmt.Sprintf("pragma table_info(%q)", name))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var colName, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[colName] = true
+	}
+	return columns, rows.Err()
+}
+
+func createTables(tx *sql.Tx, _ string) error {
+	for _, t := range v1Tables {
+		if _, err := tx.Exec(t.schema); err != nil {
+			return fmt.Errorf("error creating %v table: %v", t.name, err)
+		}
+	}
+	return nil
+}
+
+// rebuildLegacyTables recreates the tables created by the first versions, which stored
+// heights as text, had no tx and event index and, for the error table, a single malformed
+// column for the event type, tx index and event index. The columns both versions have
+// in common are copied over. The legacy events can not recover their indexes here, they
+// are copied with null ones and take the indexes of the same events when they are
+// collected again, see adoptEventsTx and migration 7.
+func rebuildLegacyTables(tx *sql.Tx, _ string) error {
+	for _, t := range v1Tables {
+		if t.name != "error" && t.name != "merged_event" && t.name != "claim_event" {
+			continue
+		}
+		columns, err := tableColumns(tx, t.name)
+		if err != nil {
+			return err
+		}
+		if columns["tx_index"] {
+			continue
+		}
+
+		legacy := t.name + "_legacy"
+		if _, err := tx.Exec(fmt.Sprintf("alter table %q rename to %q", t.name, legacy)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(t.schema); err != nil {
+			return err
+		}
+		names := []string{"id"}
+		values := []string{"id"}
+		for _, c := range t.columns {
+			if !columns[c.name] {
+				continue
+			}
+			names = append(names, c.name)
+			if c.name == "height" {
+				values = append(values, "cast(height as integer)")
+			} else {
+				values = append(values, c.name)
+			}
+		}
+		copyRows := fmt.Sprintf("insert into %q(%v) select %v from %q order by id", t.name, strings.Join(names, ", "), strings.Join(values, ", "), legacy)
+		res, err := tx.Exec(copyRows)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf("drop table %q", legacy)); err != nil {
+			return err
+		}
+		copied, _ := res.RowsAffected()
+		log.Printf("rebuilt legacy %v table, %v rows copied", t.name, copied)
+	}
+	return nil
+}
+
+// addMissingColumns adds the columns introduced after a table was created
+func addMissingColumns(tx *sql.Tx, _ string) error {
+	for _, t := range v1Tables {
+		columns, err := tableColumns(tx, t.name)
+		if err != nil {
+			return err
+		}
+		for _, c := range t.columns {
+			if columns[c.name] {
+				continue
+			}
+			if _, err := tx.Exec(fmt.Sprintf("alter table %q add column %v %v", t.name, c.name, c.definition)); err != nil {
+				return fmt.Errorf("error adding column %v.%v: %v", t.name, c.name, err)
+			}
+			log.Printf("added column %v.%v", t.name, c.name)
+		}
+	}
+	return nil
+}
+
+// splitLegacyCoins replaces the raw coins stored by the first versions, e.g. `100aevmos`,
+// with the amount of the claims denom, storing the denom on its own column
+func splitLegacyCoins(tx *sql.Tx, claimsDenom string) error {
+	splits := []struct {
+		table, amount, denom string
+	}{
+		{"claim_event", "amount", "denom"},
+		{"merged_event", "claimed_coins", "claimed_denom"},
+		{"merged_event", "fund_community_pool_coins", "fund_community_pool_denom"},
+	}
+	for _, s := range splits {
+		rows, err := tx.Query(fmt.Sprintf("select id, %v from %q where (%v is null or %v = '') and %v is not null", s.amount, s.table, s.denom, s.denom, s.amount))
+		if err != nil {
+			return err
+		}
+		amounts := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var raw string
+			if err := rows.Scan(&id, &raw); err != nil {
+				rows.Close()
+				return err
+			}
+			amounts[id] = raw
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		update, err := tx.Prepare(fmt.Sprintf("update %q set %v = ?, %v = ? where id = ?", s.table, s.amount, s.denom))
+		if err != nil {
+			return err
+		}
+		split, invalid := 0, 0
+		for id, raw := range amounts {
+			// Amounts without a denom were already split
+			if _, ok := new(big.Int).SetString(raw, 10); ok {
+				continue
+			}
+			coins, err := coin.ParseCoins(raw)
+			if err != nil {
+				log.Printf("%v %v: leaving invalid %v %q as is: %v", s.table, id, s.amount, raw, err)
+				invalid++
+				continue
+			}
+			if _, err := update.Exec(coins.AmountOf(claimsDenom).String(), claimsDenom, id); err != nil {
+				update.Close()
+				return err
+			}
+			split++
+		}
+		update.Close()
+		if split > 0 || invalid > 0 {
+			log.Printf("split %v %v.%v coins, %v invalid", split, s.table, s.amount, invalid)
+		}
+	}
+	return nil
+}
+
+// recalculateTotalLostEvmos stores total_lost_evmos as the exact decimal of total_lost,
+// leaving it empty when total_lost is not an amount. The first versions created the column
+// as a float, whose affinity turns the decimals back into floats, so the table is rebuilt
+// with a text column first.
+func recalculateTotalLostEvmos(tx *sql.Tx, _ string) error {
+	if err := rebuildDecayAmountTable(tx); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("select id, coalesce(total_lost, '') from decay_amount")
+	if err != nil {
+		return err
+	}
+	lost := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var amount string
+		if err := rows.Scan(&id, &amount); err != nil {
+			rows.Close()
+			return err
+		}
+		lost[id] = amount
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	update, err := tx.Prepare("update decay_amount set total_lost_evmos = ? where id = ?")
+	if err != nil {
+		return err
+	}
+	defer update.Close()
+	for id, amount := range lost {
+		var evmos interface{}
+		if a, ok := new(big.Int).SetString(amount, 10); ok {
+			evmos = coin.NewDecFromAtto(a).String()
+		}
+		if _, err := update.Exec(evmos, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildDecayAmountTable recreates decay_amount with the v1 schema copying every column
+// but total_lost_evmos, which is recalculated from total_lost
+func rebuildDecayAmountTable(tx *sql.Tx) error {
+	var decayAmount table
+	for _, t := range v1Tables {
+		if t.name == "decay_amount" {
+			decayAmount = t
+		}
+	}
+	if _, err := tx.Exec("alter table decay_amount rename to decay_amount_legacy"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(decayAmount.schema); err != nil {
+		return err
+	}
+	names := []string{"id"}
+	for _, c := range decayAmount.columns {
+		if c.name != "total_lost_evmos" {
+			names = append(names, c.name)
+		}
+	}
+	columns := strings.Join(names, ", ")
+	copyRows := fmt.Sprintf("insert into decay_amount(%v) select %v from decay_amount_legacy order by id", columns, columns)
+	if _, err := tx.Exec(copyRows); err != nil {
+		return err
+	}
+	_, err := tx.Exec("drop table decay_amount_legacy")
+	return err
+}
+
+// uniqueDecayAmountSender drops all but the latest decay amount of each sender,
+// previous versions appended the losses of every run
+func uniqueDecayAmountSender(tx *sql.Tx, _ string) error {
+	res, err := tx.Exec("delete from decay_amount where id not in (select max(id) from decay_amount group by sender)")
+	if err != nil {
+		return err
+	}
+	if deleted, _ := res.RowsAffected(); deleted > 0 {
+		log.Printf("deleted %v outdated decay amounts", deleted)
+	}
+	_, err = tx.Exec("create unique index if not exists decay_amount_sender on decay_amount(sender)")
+	return err
+}
+
+// dropDuplicatedUnindexedEvents drops the events without tx and event index, copied from the
+// legacy tables, that were stored again with their indexes by running collect-events over
+// the same heights. The events with the same content are paired in order, one for one, so
+// an event without indexes is only dropped if an indexed one took it over, and identical
+// events, like several merges to an account in a block, are kept. Merged events keep the
+// sender resolved for the dropped row. The partial indexes find the events without indexes
+// the collected ones replace.
+func dropDuplicatedUnindexedEvents(tx *sql.Tx, _ string) error {
+	claim, merged := contentPairing{"claim_event", claimEventContent}, contentPairing{"merged_event", mergedEventContent}
+	paired := "l.tx_index is null and " + merged.same("l", "merged_event") + " and " + merged.unindexedRank("l") + " = " + merged.indexedRank("merged_event")
+	statements := []struct {
+		table, query string
+	}{
+		{"merged_event", `update merged_event set sender = (select l.sender from merged_event l where ` + paired + `)
+			where tx_index is not null and (sender is null or sender = '')
+			and exists (select 1 from merged_event l where l.sender is not null and l.sender != '' and ` + paired + `)`},
+		{"claim_event", claim.deleteTakenOver()},
+		{"merged_event", merged.deleteTakenOver()},
+		{"claim_event", "create index if not exists claim_event_unindexed on claim_event(height) where tx_index is null"},
+		{"merged_event", "create index if not exists merged_event_unindexed on merged_event(height) where tx_index is null"},
+	}
+	for _, s := range statements {
+		res, err := tx.Exec(s.query)
+		if err != nil {
+			return fmt.Errorf("error updating %v: %v", s.table, err)
+		}
+		if deleted, _ := res.RowsAffected(); deleted > 0 && strings.HasPrefix(s.query, "delete") {
+			log.Printf("deleted %v %v rows without indexes stored again with them", deleted, s.table)
+		}
+	}
+	return nil
+}
+
+// contentPairing builds the conditions pairing the events of a table with the same content
+type contentPairing struct {
+	table   string
+	columns []string
+}
+
+// same returns the condition of the rows a and b having the same content
+func (p contentPairing) same(a, b string) string {
+	conditions := make([]string, len(p.columns))
+	for i, c := range p.columns {
+		conditions[i] = a + "." + c + " = " + b + "." + c
+	}
+	return strings.Join(conditions, " and ")
+}
+
+// unindexedRank returns the position by id of the row without indexes among the ones with its content
+func (p contentPairing) unindexedRank(row string) string {
+	return fmt.Sprintf("(select count(*) from %v r where r.tx_index is null and %v and r.id <= %v.id)", p.table, p.same("r", row), row)
+}
+
+// indexedRank returns the position by indexes of the indexed row among the ones with its content
+func (p contentPairing) indexedRank(row string) string {
+	return fmt.Sprintf("(select count(*) from %v r where r.tx_index is not null and %v and (r.tx_index < %v.tx_index or (r.tx_index = %v.tx_index and r.event_index <= %v.event_index)))",
+		p.table, p.same("r", row), row, row, row)
+}
+
+// deleteTakenOver returns the query deleting the rows without indexes paired with an indexed one
+func (p contentPairing) deleteTakenOver() string {
+	return fmt.Sprintf("delete from %v where tx_index is null and %v <= (select count(*) from %v r where r.tx_index is not null and %v)",
+		p.table, p.unindexedRank(p.table), p.table, p.same("r", p.table))
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// baselineDecayAmount is the decay_amount table created by the first versions
+const baselineDecayAmount = `
+	create table decay_amount (
+	    id integer not null primary key,
+        sender text,
+        vote_action text,
+        ibc_action text,
+        delegate_action text,
+        evm_action text,
+        total_claimed text,
+        total_lost text,
+        initial_claimable_amount text,
+        total_lost_evmos float
+	);`
+
+func TestMigrateBaselineDecayAmount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.db")
+	baseline, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inserts := []string{
+		baselineDecayAmount,
+		`insert into decay_amount(sender, vote_action, total_claimed, total_lost, initial_claimable_amount, total_lost_evmos)
+			values('evmos1a', '100', '100', '123456789012345678901', '400', 123.456789012346)`,
+		"insert into decay_amount(sender, total_lost, total_lost_evmos) values('evmos1b', '', 0)",
+	}
+	for _, insert := range inserts {
+		if _, err := baseline.Exec(insert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	baseline.Close()
+
+	d, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.Migrate("aevmos"); err != nil {
+		t.Fatal(err)
+	}
+
+	var kind string
+	if err := d.db.QueryRow("select typeof(total_lost_evmos) from decay_amount where sender = 'evmos1a'").Scan(&kind); err != nil {
+		t.Fatal(err)
+	}
+	if kind != "text" {
+		t.Errorf("got total_lost_evmos stored as %v, want text", kind)
+	}
+
+	amounts, err := d.DecayAmounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(amounts) != 2 {
+		t.Fatalf("got decay amounts %+v, want 2", amounts)
+	}
+	a, b := amounts[0], amounts[1]
+	if a.Sender != "evmos1a" || a.VoteAction != "100" || a.TotalClaimed != "100" || a.InitialClaimableAmount != "400" ||
+		a.TotalLost != "123456789012345678901" || a.TotalLostEvmos.String() != "123.456789012345678901" {
+		t.Errorf("got decay amount %+v", a)
+	}
+	if b.Sender != "evmos1b" || b.TotalLostEvmos.Sign() != 0 {
+		t.Errorf("got decay amount %+v", b)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.db")
+	if _, err := OpenReadOnly(missing); err == nil {
+		t.Error("expected an error opening a missing database")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the missing database not created", err)
+	}
+
+	path := filepath.Join(dir, "baseline.db")
+	baseline, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := baseline.Exec(baselineDecayAmount); err != nil {
+		t.Fatal(err)
+	}
+	baseline.Close()
+
+	d, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if applied, err := d.AppliedMigrations(); err != nil || len(applied) != 0 {
+		t.Errorf("got applied migrations %+v and error %v, want none", applied, err)
+	}
+	if _, err := d.Migrate("aevmos"); err == nil {
+		t.Error("expected migrating a database opened read only to fail")
+	}
+	var mode string
+	if err := d.db.QueryRow("pragma journal_mode").Scan(&mode); err != nil || mode != "delete" {
+		t.Errorf("got journal mode %q and error %v, want it left as delete", mode, err)
+	}
+}
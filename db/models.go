@@ -1,20 +1,41 @@
 package db
 
+import (
+	"time"
+
+	"github.com/facs95/decay-data/coin"
+)
+
+// UnknownIndex is the TxIndex and EventIndex of the events stored without them,
+// e.g. the ones imported from CSV files, they are stored as null
+const UnknownIndex = -1
+
+// MergedEvent amounts are integers of their denom
 type MergedEvent struct {
-	ID                int
-	Recipient         string
-	Sender            string
-	ClaimedCoins      string
-	FundCommunityPool string
-	Height            int
+	ID                     int
+	Recipient              string
+	Sender                 string
+	ClaimedCoins           string
+	ClaimedDenom           string
+	FundCommunityPool      string
+	FundCommunityPoolDenom string
+	Height                 int
+	TxIndex                int
+	EventIndex             int
+	BlockTime              time.Time
 }
 
+// ClaimEvent amount is an integer of its denom
 type ClaimEvent struct {
-	ID     int
-	Sender string
-	Action string
-	Amount string
-	Height int
+	ID         int
+	Sender     string
+	Action     string
+	Amount     string
+	Denom      string
+	Height     int
+	TxIndex    int
+	EventIndex int
+	BlockTime  time.Time
 }
 
 type DecayAmount struct {
@@ -24,10 +45,14 @@ type DecayAmount struct {
 	DelegateAction         string
 	EVMAction              string
 	IBCAction              string
+	MergedClaimed          string
+	CommunityPool          string
 	TotalClaimed           string
 	TotalLost              string
 	InitialClaimableAmount string
-	TotalLostEvmos         float64
+	TotalLostEvmos         coin.Dec
+	// Anomalies are the comma separated inconsistencies found on the claims of the account
+	Anomalies string
 }
 
 type Error struct {
@@ -36,4 +61,35 @@ type Error struct {
 	EventType  string
 	TxIndex    string
 	EventIndex string
+	Message    string
+	Resolved   bool
+	Attempts   int
+}
+
+type Progress struct {
+	ID         int
+	FromHeight int
+	ToHeight   int
+}
+
+// BlockTime is the header time of a block
+type BlockTime struct {
+	Height int
+	Time   time.Time
+}
+
+// ClaimsRecord is a genesis claims record, ActionsCompleted is the json list of the completed actions
+type ClaimsRecord struct {
+	Address                string
+	ActionsCompleted       string
+	InitialClaimableAmount string
+}
+
+// ClaimsParams are the genesis claims module params, durations are kept as found on genesis
+type ClaimsParams struct {
+	EnableClaims       bool
+	AirdropStartTime   time.Time
+	DurationUntilDecay string
+	DurationOfDecay    string
+	ClaimsDenom        string
 }
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// PostgresMigrations is the ordered list of migrations of the postgres schema,
+// versioned independently of the sqlite ones
+var PostgresMigrations = []Migration{
+	{1, "create tables", createPostgresTables},
+	{2, "drop events without indexes collected again with them", dropDuplicatedUnindexedEvents},
+}
+
+var postgresMigrations = migrationSet{
+	migrations:         PostgresMigrations,
+	recordVersion:      "insert into schema_version(version, description, applied_at) values($1,$2,$3)",
+	versionTableExists: "select count(*) from information_schema.tables where table_schema = current_schema() and table_name = 'schema_version'",
+}
+
+// postgresTables are the same tables as the sqlite ones, heights are bigints, times are
+// timestamps with time zone and total_lost_evmos keeps its 18 decimals as a numeric.
+// They are created by migration 1 and frozen, changes must be made by new migrations.
+var postgresTables = []table{
+	{
+		name: "error",
+		schema: `
+	   create table if not exists error (
+	    id bigserial primary key,
+	    height bigint,
+        event_type text,
+        tx_index text,
+        event_index text,
+        message text,
+        resolved boolean not null default false,
+        attempts int not null default 0
+	);`,
+	},
+	{
+		name: "merged_event",
+		schema: `
+	   create table if not exists merged_event (
+	    id bigserial primary key,
+	    recipient text,
+        sender text,
+        height bigint,
+        tx_index int,
+        event_index int,
+        claimed_coins text,
+        claimed_denom text,
+        fund_community_pool_coins text,
+        fund_community_pool_denom text,
+        block_time timestamptz,
+        unique(height, tx_index, event_index)
+	);`,
+	},
+	{
+		name: "claim_event",
+		schema: `
+	   create table if not exists claim_event (
+	    id bigserial primary key,
+        sender text,
+        height bigint,
+        tx_index int,
+        event_index int,
+        amount text,
+        denom text,
+        claim_action text,
+        block_time timestamptz,
+        unique(height, tx_index, event_index)
+	);`,
+	},
+	{
+		name: "decay_amount",
+		schema: `
+	   create table if not exists decay_amount (
+	    id bigserial primary key,
+        sender text unique,
+        vote_action text,
+        ibc_action text,
+        delegate_action text,
+        evm_action text,
+        merged_claimed text,
+        community_pool text,
+        total_claimed text,
+        total_lost text,
+        initial_claimable_amount text,
+        total_lost_evmos numeric(78, 18),
+        anomalies text
+	);`,
+	},
+	{
+		name: "progress",
+		schema: `
+	   create table if not exists progress (
+	    id bigserial primary key,
+        from_height bigint,
+        to_height bigint,
+        completed_at timestamptz default current_timestamp
+	);`,
+	},
+	{
+		name: "block_time",
+		schema: `
+	   create table if not exists block_time (
+	    height bigint not null primary key,
+        time timestamptz not null
+	);`,
+	},
+	{
+		name: "claims_record",
+		schema: `
+	   create table if not exists claims_record (
+	    address text not null primary key,
+        actions_completed text,
+        initial_claimable_amount text not null
+	);`,
+	},
+	{
+		name: "claims_params",
+		schema: `
+	   create table if not exists claims_params (
+	    id integer not null primary key check (id = 1),
+        enable_claims boolean,
+        airdrop_start_time timestamptz,
+        duration_until_decay text,
+        duration_of_decay text,
+        claims_denom text
+	);`,
+	},
+}
+
+func createPostgresTables(tx *sql.Tx, _ string) error {
+	for _, t := range postgresTables {
+		if _, err := tx.Exec(t.schema); err != nil {
+			return fmt.Errorf("error creating %v table: %v", t.name, err)
+		}
+	}
+	return nil
+}
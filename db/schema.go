@@ -0,0 +1,172 @@
+package db
+
+// table is the definition of a table, columns lists the definition of every column
+// so the ones missing on databases created by older versions can be added
+type table struct {
+	name    string
+	schema  string
+	columns []column
+}
+
+type column struct {
+	name       string
+	definition string
+}
+
+// v1Tables are the tables created, rebuilt and completed by migrations 1 to 3. They are
+// frozen so those migrations always produce the same schema, changes of the tables must
+// be made by new migrations instead of here.
+var v1Tables = []table{
+	{
+		name: "error",
+		schema: `
+	   create table if not exists error (
+	    id integer not null primary key,
+	    height int,
+        event_type text,
+        tx_index text,
+        event_index text,
+        message text,
+        resolved boolean not null default 0,
+        attempts int not null default 0
+	);`,
+		columns: []column{
+			{"height", "int"},
+			{"event_type", "text"},
+			{"tx_index", "text"},
+			{"event_index", "text"},
+			{"message", "text"},
+			{"resolved", "boolean not null default 0"},
+			{"attempts", "int not null default 0"},
+		},
+	},
+	{
+		name: "merged_event",
+		schema: `
+	   create table if not exists merged_event (
+	    id integer not null primary key,
+	    recipient text,
+        sender text,
+        height int,
+        tx_index int,
+        event_index int,
+        claimed_coins text,
+        claimed_denom text,
+        fund_community_pool_coins text,
+        fund_community_pool_denom text,
+        block_time timestamp,
+        unique(height, tx_index, event_index)
+	);`,
+		columns: []column{
+			{"recipient", "text"},
+			{"sender", "text"},
+			{"height", "int"},
+			{"tx_index", "int"},
+			{"event_index", "int"},
+			{"claimed_coins", "text"},
+			{"claimed_denom", "text"},
+			{"fund_community_pool_coins", "text"},
+			{"fund_community_pool_denom", "text"},
+			{"block_time", "timestamp"},
+		},
+	},
+	{
+		name: "claim_event",
+		schema: `
+	   create table if not exists claim_event (
+	    id integer not null primary key,
+        sender text,
+        height int,
+        tx_index int,
+        event_index int,
+        amount text,
+        denom text,
+        claim_action text,
+        block_time timestamp,
+        unique(height, tx_index, event_index)
+	);`,
+		columns: []column{
+			{"sender", "text"},
+			{"height", "int"},
+			{"tx_index", "int"},
+			{"event_index", "int"},
+			{"amount", "text"},
+			{"denom", "text"},
+			{"claim_action", "text"},
+			{"block_time", "timestamp"},
+		},
+	},
+	{
+		name: "decay_amount",
+		schema: `
+	   create table if not exists decay_amount (
+	    id integer not null primary key,
+        sender text,
+        vote_action text,
+        ibc_action text,
+        delegate_action text,
+        evm_action text,
+        merged_claimed text,
+        community_pool text,
+        total_claimed text,
+        total_lost text,
+        initial_claimable_amount text,
+        total_lost_evmos text,
+        anomalies text
+	);`,
+		columns: []column{
+			{"sender", "text"},
+			{"vote_action", "text"},
+			{"ibc_action", "text"},
+			{"delegate_action", "text"},
+			{"evm_action", "text"},
+			{"merged_claimed", "text"},
+			{"community_pool", "text"},
+			{"total_claimed", "text"},
+			{"total_lost", "text"},
+			{"initial_claimable_amount", "text"},
+			{"total_lost_evmos", "text"},
+			{"anomalies", "text"},
+		},
+	},
+	{
+		name: "progress",
+		schema: `
+	   create table if not exists progress (
+	    id integer not null primary key,
+        from_height int,
+        to_height int,
+        completed_at timestamp default current_timestamp
+	);`,
+	},
+	{
+		name: "block_time",
+		schema: `
+	   create table if not exists block_time (
+	    height integer not null primary key,
+        time timestamp not null
+	);`,
+	},
+	{
+		name: "claims_record",
+		schema: `
+	   create table if not exists claims_record (
+	    address text not null primary key,
+        actions_completed text,
+        initial_claimable_amount text not null
+	);`,
+	},
+	{
+		// claims_params holds the single row of genesis claims params
+		name: "claims_params",
+		schema: `
+	   create table if not exists claims_params (
+	    id integer not null primary key check (id = 1),
+        enable_claims boolean,
+        airdrop_start_time timestamp,
+        duration_until_decay text,
+        duration_of_decay text,
+        claims_denom text
+	);`,
+	},
+}
@@ -3,171 +3,271 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"golang.org/x/net/context"
 )
 
-type DB struct {
-	db *sql.DB
+// preparer is the transaction the statements are prepared on, either a *sql.Tx or one
+// rebinding the placeholders of the queries for the backend
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 }
 
-func CreateErrorTable(db *sql.DB) {
-	sqlStmt := `
-	   create table if not exists error (
-	    id integer not null primary key,
-	    height int,
-        event_type text
-        tx_index text
-        event_index text
-	);`
-	_, err := db.Exec(sqlStmt)
+func PrepareInsertErrorQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	insertError, err := tx.PrepareContext(ctx, "insert into error(height, event_type, tx_index, event_index, message) values(?,?,?,?,?)")
 	if err != nil {
-		fmt.Printf("Error executing the table creation: %q", err)
-		panic("Stop processing")
+		return nil, fmt.Errorf("error preparing statement for error: %v", err)
 	}
+	return insertError, nil
 }
 
-func CreateMergedEventTable(db *sql.DB) {
-	sqlStmt := `
-	   create table if not exists merged_event (
-	    id integer not null primary key,
-	    recipient text,
-        sender text,
-        height int,
-        claimed_coins text,
-        fund_community_pool_coins text
-	);`
-	_, err := db.Exec(sqlStmt)
+// PrepareUpsertDecayAmountQuery prepares the upsert query for decay_amount table,
+// a sender has a single decay amount holding the latest calculation
+func PrepareUpsertDecayAmountQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	insertAccount, err := tx.PrepareContext(ctx, `insert into decay_amount(sender, vote_action, ibc_action, delegate_action, evm_action, merged_claimed, community_pool, total_claimed, total_lost, initial_claimable_amount, total_lost_evmos, anomalies) values(?,?,?,?,?,?,?,?,?,?,?,?)
+		on conflict(sender) do update set
+		vote_action = excluded.vote_action, ibc_action = excluded.ibc_action, delegate_action = excluded.delegate_action, evm_action = excluded.evm_action,
+		merged_claimed = excluded.merged_claimed, community_pool = excluded.community_pool, total_claimed = excluded.total_claimed, total_lost = excluded.total_lost,
+		initial_claimable_amount = excluded.initial_claimable_amount, total_lost_evmos = excluded.total_lost_evmos, anomalies = excluded.anomalies`)
 	if err != nil {
-		fmt.Printf("Error executing the table creation: %q", err)
-		panic("Stop processing")
+		return nil, fmt.Errorf("error preparing statement for decay_amount: %v", err)
 	}
+	return insertAccount, nil
 }
 
-func CreateClaimEventTable(db *sql.DB) {
-	sqlStmt := `
-	   create table if not exists claim_event (
-	    id integer not null primary key,
-        sender text,
-        height int,
-        amount text,
-        claim_action text
-	);`
-	_, err := db.Exec(sqlStmt)
+// PrepareInsertMergeEventQuery prepares the upsert query for merged_event table.
+// Events are identified by height, tx index and event index so storing the same event
+// twice leaves a single row. The sender is left untouched as it is collected afterwards.
+func PrepareInsertMergeEventQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	insertAccount, err := tx.PrepareContext(ctx, `insert into merged_event(recipient, height, tx_index, event_index, claimed_coins, claimed_denom, fund_community_pool_coins, fund_community_pool_denom, block_time) values(?,?,?,?,?,?,?,?,?)
+		on conflict(height, tx_index, event_index) do update set
+		recipient = excluded.recipient, claimed_coins = excluded.claimed_coins, claimed_denom = excluded.claimed_denom,
+		fund_community_pool_coins = excluded.fund_community_pool_coins, fund_community_pool_denom = excluded.fund_community_pool_denom, block_time = excluded.block_time`)
 	if err != nil {
-		fmt.Printf("Error executing the table creation: %q", err)
-		panic("Stop processing")
+		return nil, fmt.Errorf("error preparing statement for merged_event: %v", err)
 	}
+	return insertAccount, nil
 }
 
-func CreateDecayAmountTable(db *sql.DB) {
-	sqlStmt := `
-	   create table if not exists decay_amount (
-	    id integer not null primary key,
-        sender text,
-        vote_action text,
-        ibc_action text,
-        delegate_action text,
-        evm_action text,
-        total_claimed text,
-        total_lost text,
-        initial_claimable_amount text,
-        total_lost_evmos float
-	);`
-	_, err := db.Exec(sqlStmt)
+func PrepareUpdateSenderMergeEventQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	updateSender, err := tx.PrepareContext(ctx, "UPDATE merged_event SET sender =  ? WHERE id = ?")
 	if err != nil {
-		fmt.Printf("Error executing the table creation: %q", err)
-		panic("Stop processing")
+		return nil, fmt.Errorf("error preparing statement for merged_event: %v", err)
 	}
+	return updateSender, nil
 }
 
-func PrepareInsertErrorQuery(ctx context.Context, tx *sql.Tx) (*sql.Stmt, error) {
-	insertError, err := tx.PrepareContext(ctx, "insert into error(height, event_type, tx_index, event_index) values(?,?,?,?)")
+// ExecContextDecayAmount executes the upsert query for decay_amount table
+func ExecContextDecayAmount(ctx context.Context, stmt *sql.Stmt, account DecayAmount) error {
+	_, err := stmt.ExecContext(ctx, account.Sender, account.VoteAction, account.IBCAction, account.DelegateAction, account.EVMAction, account.MergedClaimed, account.CommunityPool, account.TotalClaimed, account.TotalLost, account.InitialClaimableAmount, account.TotalLostEvmos, account.Anomalies)
 	if err != nil {
-		fmt.Printf("Error preparing transaction: %q", err)
-		return nil, err
+		return fmt.Errorf("error inserting data into decay_amount: %v", err)
 	}
-	return insertError, nil
+	return nil
 }
 
-// PrepareInsertDecayAmountQuery prepares the insert query for decay_amount table
-func PrepareInsertDecayAmountQuery(ctx context.Context, tx *sql.Tx) (*sql.Stmt, error) {
-	insertAccount, err := tx.PrepareContext(ctx, "insert into decay_amount(sender, vote_action, ibc_action, delegate_action, evm_action, total_claimed, total_lost, initial_claimable_amount, total_lost_evmos) values(?,?,?,?,?,?,?,?,?)")
+func ExecContextMergeEventUpdate(ctx context.Context, stmt *sql.Stmt, event MergedEvent) error {
+	_, err := stmt.ExecContext(ctx, event.Sender, event.ID)
 	if err != nil {
-		fmt.Printf("Error preparing transaction: %q", err)
-		return nil, err
+		return fmt.Errorf("error updating sender of merged_event: %v", err)
 	}
-	return insertAccount, nil
+	return nil
 }
 
-func PrepareInsertMergeEventQuery(ctx context.Context, tx *sql.Tx) (*sql.Stmt, error) {
-	insertAccount, err := tx.PrepareContext(ctx, "insert into merged_event(recipient, height, claimed_coins, fund_community_pool_coins) values(?,?,?,?)")
+func ExecContextError(ctx context.Context, stmt *sql.Stmt, error Error) error {
+	_, err := stmt.ExecContext(ctx, error.Height, error.EventType, error.TxIndex, error.EventIndex, error.Message)
 	if err != nil {
-		fmt.Printf("Error preparing transaction: %q", err)
-		return nil, err
+		return fmt.Errorf("error inserting data into error: %v", err)
 	}
-	return insertAccount, nil
+	return nil
 }
 
-func PrepareUpdateSenderMergeEventQuery(ctx context.Context, tx *sql.Tx) (*sql.Stmt, error) {
-	updateSender, err := tx.PrepareContext(ctx, "UPDATE merged_event SET sender =  ? WHERE id = ?")
+// PrepareUpdateErrorQuery prepares the query that records a retry of a failed height
+func PrepareUpdateErrorQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	updateError, err := tx.PrepareContext(ctx, "UPDATE error SET resolved = ?, attempts = attempts + 1 WHERE id = ?")
 	if err != nil {
-		fmt.Printf("Error preparing transaction: %q", err)
-		return nil, err
+		return nil, fmt.Errorf("error preparing statement for error: %v", err)
 	}
-	return updateSender, nil
+	return updateError, nil
 }
 
-// ExecContextDecayAmount executes the insert query for decay_amount table
-func ExecContextDecayAmount(ctx context.Context, stmt *sql.Stmt, account DecayAmount) error {
-	// Insert data into Table1
-	_, err := stmt.ExecContext(ctx, account.Sender, account.VoteAction, account.IBCAction, account.DelegateAction, account.EVMAction, account.TotalClaimed, account.TotalLost, account.InitialClaimableAmount, account.TotalLostEvmos)
+// ExecContextErrorUpdate marks the error as resolved or not and increments its attempts
+func ExecContextErrorUpdate(ctx context.Context, stmt *sql.Stmt, error Error) error {
+	_, err := stmt.ExecContext(ctx, error.Resolved, error.ID)
 	if err != nil {
-		return fmt.Errorf("error inserting data into DecayAmount: %v", err)
+		return fmt.Errorf("error updating data into error: %v", err)
 	}
 	return nil
 }
 
-func ExecContextMergeEventUpdate(ctx context.Context, stmt *sql.Stmt, event MergedEvent) error {
-	_, err := stmt.ExecContext(ctx, event.Sender, event.ID)
+func ExecContextMergedEvent(ctx context.Context, stmt *sql.Stmt, account MergedEvent) error {
+	_, err := stmt.ExecContext(ctx, account.Recipient, account.Height, account.TxIndex, account.EventIndex, account.ClaimedCoins, account.ClaimedDenom, account.FundCommunityPool, account.FundCommunityPoolDenom, account.BlockTime)
 	if err != nil {
-		return fmt.Errorf("error inserting data into MergedAccount: %v", err)
+		return fmt.Errorf("error inserting data into merged_event: %v", err)
 	}
 	return nil
 }
 
-func ExecContextError(ctx context.Context, stmt *sql.Stmt, error Error) error {
-	// Insert data into Error
-	_, err := stmt.ExecContext(ctx, error.Height, error.EventType, error.TxIndex, error.EventIndex)
+// PrepareInsertClaimEventQuery prepares the upsert query for claim_event table.
+// Events are identified by height, tx index and event index so storing the same event
+// twice leaves a single row.
+func PrepareInsertClaimEventQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	insertAccount, err := tx.PrepareContext(ctx, `insert into claim_event(sender, height, tx_index, event_index, amount, denom, claim_action, block_time) values(?,?,?,?,?,?,?,?)
+		on conflict(height, tx_index, event_index) do update set
+		sender = excluded.sender, amount = excluded.amount, denom = excluded.denom, claim_action = excluded.claim_action, block_time = excluded.block_time`)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing statement for claim_event: %v", err)
+	}
+	return insertAccount, nil
+}
+
+// Events stored without tx and event index, by the first versions or imported from files
+// without them, are identified by their content instead
+var (
+	claimEventContent  = []string{"height", "sender", "claim_action", "amount"}
+	mergedEventContent = []string{"height", "recipient", "claimed_coins", "fund_community_pool_coins"}
+)
+
+func claimContent(e ClaimEvent) []interface{} {
+	return []interface{}{e.Height, e.Sender, e.Action, e.Amount}
+}
+
+func mergedContent(e MergedEvent) []interface{} {
+	return []interface{}{e.Height, e.Recipient, e.ClaimedCoins, e.FundCommunityPool}
+}
+
+// adoptArgs are the arguments of the queries adopting an event stored without indexes
+func adoptArgs(height, txIndex, eventIndex int, content []interface{}) []interface{} {
+	args := append([]interface{}{txIndex, eventIndex}, content...)
+	return append(args, height, txIndex, eventIndex)
+}
+
+// sameContent returns the condition of the content columns being equal to placeholders
+func sameContent(columns []string) string {
+	conditions := make([]string, len(columns))
+	for i, c := range columns {
+		conditions[i] = c + " = ?"
+	}
+	return strings.Join(conditions, " and ")
+}
+
+// PrepareAdoptClaimEventQuery prepares the query setting the tx and event index of a claim event
+// stored without them with the same content, unless an event already has those indexes
+func PrepareAdoptClaimEventQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	adopt, err := tx.PrepareContext(ctx, `update claim_event set tx_index = ?, event_index = ?
+		where id = (select min(id) from claim_event where tx_index is null and `+sameContent(claimEventContent)+`)
+		and not exists (select 1 from claim_event where height = ? and tx_index = ? and event_index = ?)`)
 	if err != nil {
-		return fmt.Errorf("error inserting data into MergedAccount: %v", err)
+		return nil, fmt.Errorf("error preparing statement for claim_event: %v", err)
+	}
+	return adopt, nil
+}
+
+// ExecContextAdoptClaimEvent returns whether a claim event stored without indexes took the ones of the event
+func ExecContextAdoptClaimEvent(ctx context.Context, stmt *sql.Stmt, event ClaimEvent) (bool, error) {
+	res, err := stmt.ExecContext(ctx, adoptArgs(event.Height, event.TxIndex, event.EventIndex, claimContent(event))...)
+	if err != nil {
+		return false, fmt.Errorf("error updating indexes of claim_event: %v", err)
+	}
+	return rowsAffected(res) > 0, nil
+}
+
+// PrepareAdoptMergedEventQuery prepares the query setting the tx and event index of a merged event
+// stored without them with the same content, unless an event already has those indexes
+func PrepareAdoptMergedEventQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	adopt, err := tx.PrepareContext(ctx, `update merged_event set tx_index = ?, event_index = ?
+		where id = (select min(id) from merged_event where tx_index is null and `+sameContent(mergedEventContent)+`)
+		and not exists (select 1 from merged_event where height = ? and tx_index = ? and event_index = ?)`)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing statement for merged_event: %v", err)
+	}
+	return adopt, nil
+}
+
+// ExecContextAdoptMergedEvent returns whether a merged event stored without indexes took the ones of the event
+func ExecContextAdoptMergedEvent(ctx context.Context, stmt *sql.Stmt, event MergedEvent) (bool, error) {
+	res, err := stmt.ExecContext(ctx, adoptArgs(event.Height, event.TxIndex, event.EventIndex, mergedContent(event))...)
+	if err != nil {
+		return false, fmt.Errorf("error updating indexes of merged_event: %v", err)
+	}
+	return rowsAffected(res) > 0, nil
+}
+
+func ExecContextClaimEvent(ctx context.Context, stmt *sql.Stmt, account ClaimEvent) error {
+	_, err := stmt.ExecContext(ctx, account.Sender, account.Height, account.TxIndex, account.EventIndex, account.Amount, account.Denom, account.Action, account.BlockTime)
+	if err != nil {
+		return fmt.Errorf("error inserting data into claim_event: %v", err)
 	}
 	return nil
 }
 
-func ExecContextMergedEvent(ctx context.Context, stmt *sql.Stmt, account MergedEvent) error {
-	// Insert data into Table1
-	_, err := stmt.ExecContext(ctx, account.Recipient, account.Height, account.ClaimedCoins, account.FundCommunityPool)
+// PrepareInsertProgressQuery prepares the insert query for progress table
+func PrepareInsertProgressQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	insertProgress, err := tx.PrepareContext(ctx, "insert into progress(from_height, to_height) values(?,?)")
+	if err != nil {
+		return nil, fmt.Errorf("error preparing statement for progress: %v", err)
+	}
+	return insertProgress, nil
+}
+
+// ExecContextProgress marks a batch of blocks as completed
+func ExecContextProgress(ctx context.Context, stmt *sql.Stmt, progress Progress) error {
+	_, err := stmt.ExecContext(ctx, progress.FromHeight, progress.ToHeight)
 	if err != nil {
-		return fmt.Errorf("error inserting data into MergedAccount: %v", err)
+		return fmt.Errorf("error inserting data into progress: %v", err)
 	}
 	return nil
 }
 
-func PrepareInsertClaimEventQuery(ctx context.Context, tx *sql.Tx) (*sql.Stmt, error) {
-	insertAccount, err := tx.PrepareContext(ctx, "insert into claim_event(sender, height, amount, claim_action) values(?,?,?,?)")
+// PrepareInsertBlockTimeQuery prepares the insert query for block_time table, heights already stored are kept
+func PrepareInsertBlockTimeQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	insertBlockTime, err := tx.PrepareContext(ctx, "insert into block_time(height, time) values(?,?) on conflict(height) do nothing")
 	if err != nil {
-		fmt.Printf("Error preparing transaction: %q", err)
-		return nil, err
+		return nil, fmt.Errorf("error preparing statement for block_time: %v", err)
 	}
-	return insertAccount, nil
+	return insertBlockTime, nil
 }
 
-func ExecContextClaimEvent(ctx context.Context, stmt *sql.Stmt, account ClaimEvent) error {
-	// Insert data into Table1
-	_, err := stmt.ExecContext(ctx, account.Sender, account.Height, account.Amount, account.Action)
+// ExecContextBlockTime caches the time of a block
+func ExecContextBlockTime(ctx context.Context, stmt *sql.Stmt, blockTime BlockTime) error {
+	_, err := stmt.ExecContext(ctx, blockTime.Height, blockTime.Time.UTC())
+	if err != nil {
+		return fmt.Errorf("error inserting data into block_time: %v", err)
+	}
+	return nil
+}
+
+// PrepareInsertClaimsRecordQuery prepares the upsert query for claims_record table
+func PrepareInsertClaimsRecordQuery(ctx context.Context, tx preparer) (*sql.Stmt, error) {
+	insertRecord, err := tx.PrepareContext(ctx, `insert into claims_record(address, actions_completed, initial_claimable_amount) values(?,?,?)
+		on conflict(address) do update set
+		actions_completed = excluded.actions_completed, initial_claimable_amount = excluded.initial_claimable_amount`)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing statement for claims_record: %v", err)
+	}
+	return insertRecord, nil
+}
+
+// ExecContextClaimsRecord stores a genesis claims record
+func ExecContextClaimsRecord(ctx context.Context, stmt *sql.Stmt, record ClaimsRecord) error {
+	_, err := stmt.ExecContext(ctx, record.Address, record.ActionsCompleted, record.InitialClaimableAmount)
+	if err != nil {
+		return fmt.Errorf("error inserting data into claims_record: %v", err)
+	}
+	return nil
+}
+
+// ExecContextClaimsParams replaces the stored genesis claims params
+func ExecContextClaimsParams(ctx context.Context, tx preparer, params ClaimsParams) error {
+	_, err := tx.ExecContext(ctx, `insert into claims_params(id, enable_claims, airdrop_start_time, duration_until_decay, duration_of_decay, claims_denom) values(1,?,?,?,?,?)
+		on conflict(id) do update set
+		enable_claims = excluded.enable_claims, airdrop_start_time = excluded.airdrop_start_time, duration_until_decay = excluded.duration_until_decay,
+		duration_of_decay = excluded.duration_of_decay, claims_denom = excluded.claims_denom`,
+		params.EnableClaims, params.AirdropStartTime.UTC(), params.DurationUntilDecay, params.DurationOfDecay, params.ClaimsDenom)
 	if err != nil {
-		return fmt.Errorf("error inserting data into MigratedAccount: %v", err)
+		return fmt.Errorf("error inserting data into claims_params: %v", err)
 	}
 	return nil
 }
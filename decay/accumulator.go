@@ -0,0 +1,264 @@
+package decay
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Claim actions as emitted on the claim events
+const (
+	ActionVote        = "ACTION_VOTE"
+	ActionDelegate    = "ACTION_DELEGATE"
+	ActionEVM         = "ACTION_EVM"
+	ActionIBCTransfer = "ACTION_IBC_TRANSFER"
+)
+
+// Anomaly flags the inconsistencies found while accumulating the claims of an account
+type Anomaly uint
+
+const (
+	// AnomalyNotInGenesis the account has no claims record on genesis, its losses can not be calculated
+	AnomalyNotInGenesis Anomaly = 1 << iota
+	// AnomalyDoubleClaim an action was claimed more than once, only the first claim is counted
+	AnomalyDoubleClaim
+	// AnomalyUnknownAction a claim has an unknown action, it is not counted
+	AnomalyUnknownAction
+	// AnomalyOverClaimed the account claimed more than its initial claimable amount
+	AnomalyOverClaimed
+	// AnomalyBuggyMismatch a claimed amount differs from the one of the buggy schedule
+	AnomalyBuggyMismatch
+	// AnomalyMergeSenderUnknown a merge sender is not resolved or not on genesis, its losses can not be calculated
+	AnomalyMergeSenderUnknown
+	// AnomalyUnevenMerge a merge does not add up to whole actions of the sender, its losses can not be calculated
+	AnomalyUnevenMerge
+)
+
+var anomalyNames = []struct {
+	anomaly Anomaly
+	name    string
+}{
+	{AnomalyNotInGenesis, "not_in_genesis"},
+	{AnomalyDoubleClaim, "double_claim"},
+	{AnomalyUnknownAction, "unknown_action"},
+	{AnomalyOverClaimed, "over_claimed"},
+	{AnomalyBuggyMismatch, "buggy_mismatch"},
+	{AnomalyMergeSenderUnknown, "merge_sender_unknown"},
+	{AnomalyUnevenMerge, "uneven_merge"},
+}
+
+// Has reports whether all the flags of other are set
+func (a Anomaly) Has(other Anomaly) bool {
+	return a&other == other
+}
+
+// String returns the comma separated names of the flags set
+func (a Anomaly) String() string {
+	names := []string{}
+	for _, n := range anomalyNames {
+		if a.Has(n.anomaly) {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseAnomalies returns the flags of their comma separated names, as returned by String
+func ParseAnomalies(s string) (Anomaly, error) {
+	var a Anomaly
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, n := range anomalyNames {
+			if n.name == name {
+				a |= n.anomaly
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown anomaly %q", name)
+		}
+	}
+	return a, nil
+}
+
+// Event is a single action claimed by an account
+type Event struct {
+	Sender    string
+	Action    string
+	Amount    *big.Int
+	BlockTime time.Time
+	// InitialClaimable of the sender on genesis, nil when the sender is not on genesis
+	InitialClaimable *big.Int
+}
+
+// Merge is a merge_claims_records event, the claims record of the IBC sender
+// being claimed for the actions completed by the recipient
+type Merge struct {
+	Recipient string
+	Sender    string
+	// Claimed is the amount paid to the recipient
+	Claimed *big.Int
+	// CommunityPool is the decayed amount sent to the community pool instead
+	CommunityPool *big.Int
+	BlockTime     time.Time
+	// InitialClaimable of the sender on genesis, nil when the sender is not resolved or not on genesis
+	InitialClaimable *big.Int
+}
+
+// Account is the accumulated state of the claims of an account
+type Account struct {
+	Sender string
+	// InitialClaimable is nil when the account is not on genesis
+	InitialClaimable *big.Int
+	// Actions holds the amount claimed by action
+	Actions map[string]*big.Int
+	// MergedClaimed is the amount received from the merged claims records of other accounts
+	MergedClaimed *big.Int
+	// CommunityPool is the amount of the merged claims records diverted to the community pool
+	CommunityPool *big.Int
+	// TotalClaimed includes the claimed actions and merges
+	TotalClaimed *big.Int
+	// TotalLost is the sum of the losses of every counted action
+	TotalLost *big.Int
+	Anomalies Anomaly
+}
+
+// Accumulator aggregates the claim events of every account into their total claimed and lost amounts
+type Accumulator struct {
+	model    Model
+	accounts map[string]*Account
+}
+
+// NewAccumulator returns an empty accumulator calculating the losses with model
+func NewAccumulator(model Model) *Accumulator {
+	return &Accumulator{
+		model:    model,
+		accounts: make(map[string]*Account),
+	}
+}
+
+// account returns the state of the address creating it on its first event
+func (a *Accumulator) account(address string) *Account {
+	account, ok := a.accounts[address]
+	if !ok {
+		account = &Account{
+			Sender:        address,
+			Actions:       make(map[string]*big.Int),
+			MergedClaimed: big.NewInt(0),
+			CommunityPool: big.NewInt(0),
+			TotalClaimed:  big.NewInt(0),
+			TotalLost:     big.NewInt(0),
+		}
+		a.accounts[address] = account
+	}
+	return account
+}
+
+// Add accumulates a claim event and returns the flags it raised on its account
+func (a *Accumulator) Add(e Event) Anomaly {
+	account := a.account(e.Sender)
+	if account.InitialClaimable == nil && e.InitialClaimable != nil {
+		account.InitialClaimable = new(big.Int).Set(e.InitialClaimable)
+	}
+
+	var raised Anomaly
+	switch {
+	case !isAction(e.Action):
+		raised |= AnomalyUnknownAction
+	case account.Actions[e.Action] != nil:
+		raised |= AnomalyDoubleClaim
+	default:
+		account.Actions[e.Action] = new(big.Int).Set(e.Amount)
+		account.TotalClaimed.Add(account.TotalClaimed, e.Amount)
+
+		if account.InitialClaimable == nil {
+			raised |= AnomalyNotInGenesis
+			break
+		}
+		if account.claimedActions().Cmp(account.InitialClaimable) > 0 {
+			raised |= AnomalyOverClaimed
+		}
+		claim := a.model.Loss(account.InitialClaimable, e.Amount, e.BlockTime)
+		if a.model.Buggy != nil && claim.Buggy.Cmp(e.Amount) != 0 {
+			raised |= AnomalyBuggyMismatch
+		}
+		account.TotalLost.Add(account.TotalLost, claim.Lost)
+	}
+
+	account.Anomalies |= raised
+	return raised
+}
+
+// AddMerge accumulates a merge on the recipient account and returns the flags it raised.
+// The claims module pays a whole action of the sender record for every action completed by the recipient,
+// each one split between the claimed amount and the decayed amount sent to the community pool.
+func (a *Accumulator) AddMerge(m Merge) Anomaly {
+	account := a.account(m.Recipient)
+	account.MergedClaimed.Add(account.MergedClaimed, m.Claimed)
+	account.CommunityPool.Add(account.CommunityPool, m.CommunityPool)
+	account.TotalClaimed.Add(account.TotalClaimed, m.Claimed)
+
+	var raised Anomaly
+	defer func() { account.Anomalies |= raised }()
+
+	if m.InitialClaimable == nil {
+		raised |= AnomalyMergeSenderUnknown
+		return raised
+	}
+	perAction := new(big.Int).Quo(m.InitialClaimable, big.NewInt(NumActions))
+	if perAction.Sign() == 0 {
+		raised |= AnomalyUnevenMerge
+		return raised
+	}
+	merged := new(big.Int).Add(m.Claimed, m.CommunityPool)
+	actions, rem := new(big.Int).QuoRem(merged, perAction, new(big.Int))
+	if rem.Sign() != 0 || actions.Sign() <= 0 || actions.Cmp(big.NewInt(NumActions)) > 0 {
+		raised |= AnomalyUnevenMerge
+		return raised
+	}
+
+	expected := new(big.Int).Mul(actions, a.model.Correct.ClaimableForAction(m.InitialClaimable, m.BlockTime))
+	buggy := new(big.Int).Set(m.Claimed)
+	if a.model.Buggy != nil {
+		buggy.Mul(actions, a.model.Buggy.ClaimableForAction(m.InitialClaimable, m.BlockTime))
+		if buggy.Cmp(m.Claimed) != 0 {
+			raised |= AnomalyBuggyMismatch
+		}
+	}
+	account.TotalLost.Add(account.TotalLost, expected.Sub(expected, buggy))
+	return raised
+}
+
+// claimedActions returns the amount claimed by the account own actions
+func (account *Account) claimedActions() *big.Int {
+	total := big.NewInt(0)
+	for _, amount := range account.Actions {
+		total.Add(total, amount)
+	}
+	return total
+}
+
+// Accounts returns the accumulated accounts sorted by sender
+func (a *Accumulator) Accounts() []*Account {
+	accounts := make([]*Account, 0, len(a.accounts))
+	for _, account := range a.accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Sender < accounts[j].Sender })
+	return accounts
+}
+
+func isAction(action string) bool {
+	switch action {
+	case ActionVote, ActionDelegate, ActionEVM, ActionIBCTransfer:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package decay
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+var airdropStart = time.Date(2022, 4, 27, 0, 0, 0, 0, time.UTC)
+
+// testModel decays the claims between 1 and 5 hours after the airdrop start, the buggy
+// schedule started decaying them right away
+func testModel(buggy bool) Model {
+	m := Model{Correct: Schedule{AirdropStartTime: airdropStart, DurationUntilDecay: time.Hour, DurationOfDecay: 4 * time.Hour}}
+	if buggy {
+		m.Buggy = &Schedule{AirdropStartTime: airdropStart, DurationOfDecay: 4 * time.Hour}
+	}
+	return m
+}
+
+func at(hours float64) time.Time {
+	return airdropStart.Add(time.Duration(hours * float64(time.Hour)))
+}
+
+func claim(action string, amount int64, hours float64, initial int64) Event {
+	e := Event{Sender: "evmos1a", Action: action, Amount: big.NewInt(amount), BlockTime: at(hours)}
+	if initial != 0 {
+		e.InitialClaimable = big.NewInt(initial)
+	}
+	return e
+}
+
+func merge(claimed, communityPool int64, hours float64, initial int64) Merge {
+	m := Merge{Recipient: "evmos1a", Sender: "osmo1b", Claimed: big.NewInt(claimed), CommunityPool: big.NewInt(communityPool), BlockTime: at(hours)}
+	if initial != 0 {
+		m.InitialClaimable = big.NewInt(initial)
+	}
+	return m
+}
+
+func TestAccumulator(t *testing.T) {
+	tests := []struct {
+		name      string
+		buggy     bool
+		claims    []Event
+		merges    []Merge
+		claimed   int64
+		lost      int64
+		anomalies Anomaly
+	}{
+		{
+			name:    "claim before the decay",
+			claims:  []Event{claim(ActionVote, 100, 0.5, 400)},
+			claimed: 100,
+		},
+		{
+			name:    "claim when the decay starts",
+			claims:  []Event{claim(ActionVote, 100, 1, 400)},
+			claimed: 100,
+		},
+		{
+			// 50 were claimable halfway through the decay
+			name:    "claim during the decay",
+			claims:  []Event{claim(ActionVote, 100, 0.5, 400), claim(ActionEVM, 10, 3, 400)},
+			claimed: 110,
+			lost:    40,
+		},
+		{
+			name:    "claim after the decay",
+			claims:  []Event{claim(ActionVote, 0, 6, 400)},
+			claimed: 0,
+		},
+		{
+			name:      "not in genesis",
+			claims:    []Event{claim(ActionVote, 10, 3, 0)},
+			claimed:   10,
+			anomalies: AnomalyNotInGenesis,
+		},
+		{
+			name:      "double claim",
+			claims:    []Event{claim(ActionVote, 10, 3, 400), claim(ActionVote, 10, 3, 400)},
+			claimed:   10,
+			lost:      40,
+			anomalies: AnomalyDoubleClaim,
+		},
+		{
+			name:      "unknown action",
+			claims:    []Event{claim("ACTION_FLY", 10, 3, 400)},
+			anomalies: AnomalyUnknownAction,
+		},
+		{
+			// The last claim is one more than claimable
+			name: "over claimed",
+			claims: []Event{
+				claim(ActionVote, 100, 0.5, 400), claim(ActionDelegate, 100, 0.5, 400),
+				claim(ActionEVM, 100, 0.5, 400), claim(ActionIBCTransfer, 101, 0.5, 400),
+			},
+			claimed:   401,
+			lost:      -1,
+			anomalies: AnomalyOverClaimed,
+		},
+		{
+			// 25 were claimable under the buggy schedule, the claimed amount is not used
+			name:    "claim matching the buggy schedule",
+			buggy:   true,
+			claims:  []Event{claim(ActionVote, 25, 3, 400)},
+			claimed: 25,
+			lost:    25,
+		},
+		{
+			name:      "claim not matching the buggy schedule",
+			buggy:     true,
+			claims:    []Event{claim(ActionVote, 30, 3, 400)},
+			claimed:   30,
+			lost:      25,
+			anomalies: AnomalyBuggyMismatch,
+		},
+		{
+			name:    "merge of an action before the decay",
+			merges:  []Merge{merge(200, 0, 0.5, 800)},
+			claimed: 200,
+		},
+		{
+			// 100 per action were claimable
+			name:    "merge of two actions during the decay",
+			merges:  []Merge{merge(80, 320, 3, 800)},
+			claimed: 80,
+			lost:    120,
+		},
+		{
+			name:      "merge that is not a whole action",
+			merges:    []Merge{merge(150, 0, 0.5, 800)},
+			claimed:   150,
+			anomalies: AnomalyUnevenMerge,
+		},
+		{
+			name:      "merge of more than every action",
+			merges:    []Merge{merge(1000, 0, 0.5, 800)},
+			claimed:   1000,
+			anomalies: AnomalyUnevenMerge,
+		},
+		{
+			name:      "merge of an unknown sender",
+			merges:    []Merge{merge(200, 0, 0.5, 0)},
+			claimed:   200,
+			anomalies: AnomalyMergeSenderUnknown,
+		},
+		{
+			// 50 per action were claimable under the buggy schedule
+			name:    "merge matching the buggy schedule",
+			buggy:   true,
+			merges:  []Merge{merge(50, 150, 3, 800)},
+			claimed: 50,
+			lost:    50,
+		},
+		{
+			name:      "merge not matching the buggy schedule",
+			buggy:     true,
+			merges:    []Merge{merge(60, 140, 3, 800)},
+			claimed:   60,
+			lost:      50,
+			anomalies: AnomalyBuggyMismatch,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAccumulator(testModel(tc.buggy))
+			for _, e := range tc.claims {
+				a.Add(e)
+			}
+			for _, m := range tc.merges {
+				a.AddMerge(m)
+			}
+			accounts := a.Accounts()
+			if len(accounts) != 1 {
+				t.Fatalf("got %v accounts, want 1", len(accounts))
+			}
+			account := accounts[0]
+			if account.TotalClaimed.Int64() != tc.claimed || account.TotalLost.Int64() != tc.lost || account.Anomalies != tc.anomalies {
+				t.Errorf("got claimed %v, lost %v and anomalies %q, want %v, %v and %q",
+					account.TotalClaimed, account.TotalLost, account.Anomalies, tc.claimed, tc.lost, tc.anomalies)
+			}
+		})
+	}
+}
+
+func TestAccumulatorMergeTotals(t *testing.T) {
+	a := NewAccumulator(testModel(false))
+	a.Add(claim(ActionVote, 100, 0.5, 400))
+	a.AddMerge(merge(80, 320, 3, 800))
+
+	account := a.Accounts()[0]
+	if account.MergedClaimed.Int64() != 80 || account.CommunityPool.Int64() != 320 ||
+		account.Actions[ActionVote].Int64() != 100 || account.InitialClaimable.Int64() != 400 {
+		t.Errorf("got account %+v", account)
+	}
+}
+
+func TestAnomalyString(t *testing.T) {
+	if got := (AnomalyOverClaimed | AnomalyBuggyMismatch).String(); got != "over_claimed,buggy_mismatch" {
+		t.Errorf("got %q", got)
+	}
+	if got := Anomaly(0).String(); got != "" {
+		t.Errorf("got %q, want no anomalies", got)
+	}
+}
+
+func TestParseAnomalies(t *testing.T) {
+	all := AnomalyNotInGenesis | AnomalyDoubleClaim | AnomalyUnknownAction | AnomalyOverClaimed |
+		AnomalyBuggyMismatch | AnomalyMergeSenderUnknown | AnomalyUnevenMerge
+	for _, a := range []Anomaly{0, AnomalyOverClaimed, AnomalyOverClaimed | AnomalyUnevenMerge, all} {
+		got, err := ParseAnomalies(a.String())
+		if err != nil || got != a {
+			t.Errorf("got %v and error %v parsing %q", got, err, a.String())
+		}
+	}
+	if _, err := ParseAnomalies("over_claimed,lucky"); err == nil {
+		t.Error("expected an error for an unknown anomaly")
+	}
+}
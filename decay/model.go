@@ -0,0 +1,39 @@
+package decay
+
+import (
+	"math/big"
+	"time"
+)
+
+// Model computes the amount lost on each claim as the difference between
+// the amount claimable under the correct schedule and under the buggy one
+type Model struct {
+	Correct Schedule
+	// Buggy is the schedule applied while the bug was enabled.
+	// When nil the amounts actually claimed are used as the buggy amounts.
+	Buggy *Schedule
+}
+
+// Claim holds the amounts of a single action claim under both schedules
+type Claim struct {
+	// Expected is the amount claimable under the correct schedule
+	Expected *big.Int
+	// Buggy is the amount claimable under the buggy schedule
+	Buggy *big.Int
+	// Lost is Expected minus Buggy
+	Lost *big.Int
+}
+
+// Loss reconstructs the claim of a single action done at blockTime
+func (m Model) Loss(initialClaimable *big.Int, claimed *big.Int, blockTime time.Time) Claim {
+	expected := m.Correct.ClaimableForAction(initialClaimable, blockTime)
+	buggy := new(big.Int).Set(claimed)
+	if m.Buggy != nil {
+		buggy = m.Buggy.ClaimableForAction(initialClaimable, blockTime)
+	}
+	return Claim{
+		Expected: expected,
+		Buggy:    buggy,
+		Lost:     new(big.Int).Sub(expected, buggy),
+	}
+}
@@ -0,0 +1,97 @@
+// Package decay reconstructs the amounts paid by the claims module under a decay schedule
+package decay
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/facs95/decay-data/query"
+)
+
+// NumActions is the amount of claimable actions, each one gives a quarter of the initial claimable amount
+const NumActions = 4
+
+// precision is the 10^18 precision of the sdk decimals used by the claims module
+var precision = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+// Schedule is the claims decay schedule: the claimable amounts decay linearly to zero
+// during DurationOfDecay, starting DurationUntilDecay after AirdropStartTime
+type Schedule struct {
+	AirdropStartTime   time.Time
+	DurationUntilDecay time.Duration
+	DurationOfDecay    time.Duration
+}
+
+// ScheduleFromParams returns the schedule defined by the genesis claims params
+func ScheduleFromParams(params query.ClaimsParams) (Schedule, error) {
+	durationUntilDecay, err := time.ParseDuration(params.DurationUntilDecay)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("invalid duration until decay: %v", err)
+	}
+	durationOfDecay, err := time.ParseDuration(params.DurationOfDecay)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("invalid duration of decay: %v", err)
+	}
+	s := Schedule{
+		AirdropStartTime:   params.AirdropStartTime,
+		DurationUntilDecay: durationUntilDecay,
+		DurationOfDecay:    durationOfDecay,
+	}
+	return s, s.Validate()
+}
+
+// Validate checks the schedule is usable
+func (s Schedule) Validate() error {
+	if s.AirdropStartTime.IsZero() {
+		return fmt.Errorf("airdrop start time is not set")
+	}
+	if s.DurationUntilDecay < 0 {
+		return fmt.Errorf("duration until decay can not be negative")
+	}
+	if s.DurationOfDecay <= 0 {
+		return fmt.Errorf("duration of decay must be positive")
+	}
+	return nil
+}
+
+// ClaimableForAction returns the amount claimable for a single action at blockTime.
+// It mirrors the claims module GetClaimableAmountForAction, including the sdk decimal
+// truncation and bankers rounding, so the result matches the amounts paid on chain.
+func (s Schedule) ClaimableForAction(initialClaimable *big.Int, blockTime time.Time) *big.Int {
+	perAction := new(big.Int).Quo(initialClaimable, big.NewInt(NumActions))
+
+	elapsed := blockTime.Sub(s.AirdropStartTime)
+	// Are we early enough in the airdrop s.t. theres no decay?
+	if elapsed <= s.DurationUntilDecay {
+		return perAction
+	}
+	// The entire airdrop has completed
+	if elapsed > s.DurationUntilDecay+s.DurationOfDecay {
+		return big.NewInt(0)
+	}
+
+	// decayPercent = decayTime / durationOfDecay with 18 decimals, truncated
+	decayTime := elapsed - s.DurationUntilDecay
+	decayPercent := new(big.Int).Mul(big.NewInt(decayTime.Nanoseconds()), precision)
+	decayPercent.Quo(decayPercent, big.NewInt(s.DurationOfDecay.Nanoseconds()))
+	claimablePercent := new(big.Int).Sub(precision, decayPercent)
+
+	return roundDec(claimablePercent.Mul(claimablePercent, perAction))
+}
+
+// roundDec rounds a non negative 18 decimals value to an integer using bankers rounding
+func roundDec(d *big.Int) *big.Int {
+	quo, rem := new(big.Int).QuoRem(d, precision, new(big.Int))
+	half := new(big.Int).Quo(precision, big.NewInt(2))
+	switch rem.Cmp(half) {
+	case -1:
+		return quo
+	case 1:
+		return quo.Add(quo, big.NewInt(1))
+	}
+	if quo.Bit(0) == 1 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	return quo
+}
@@ -0,0 +1,63 @@
+package decay
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/facs95/decay-data/query"
+)
+
+func TestClaimableForAction(t *testing.T) {
+	s := Schedule{AirdropStartTime: airdropStart, DurationUntilDecay: time.Hour, DurationOfDecay: 3 * time.Hour}
+	tests := []struct {
+		name    string
+		initial string
+		hours   float64
+		want    string
+	}{
+		{"before the decay", "400", 0.5, "100"},
+		{"when the decay starts", "400", 1, "100"},
+		{"when the decay ends", "400", 4, "0"},
+		{"after the decay", "400", 5, "0"},
+		// the remainder of the initial amount is not claimable
+		{"uneven initial amount", "403", 0.5, "100"},
+		// 0.5 and 2.5 round to even, 1.5 rounds up
+		{"half rounds to even down", "4", 2.5, "0"},
+		{"half rounds to even up", "12", 2.5, "2"},
+		{"half of an even amount", "20", 2.5, "2"},
+		{"above half rounds up", "4", 2, "1"},
+		{"below half rounds down", "4", 3, "0"},
+		// the decayed third is truncated to 18 decimals, leaving 0.666666666666666667 claimable
+		{"truncated decay percent", "12000000000000000000", 2, "2000000000000000001"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			initial, _ := new(big.Int).SetString(tc.initial, 10)
+			if got := s.ClaimableForAction(initial, at(tc.hours)); got.String() != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScheduleFromParams(t *testing.T) {
+	params := query.ClaimsParams{AirdropStartTime: airdropStart, DurationUntilDecay: "2629800s", DurationOfDecay: "5259600s"}
+	s, err := ScheduleFromParams(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.DurationUntilDecay != 730*time.Hour+30*time.Minute || s.DurationOfDecay != 1461*time.Hour {
+		t.Errorf("got schedule %+v", s)
+	}
+
+	for _, p := range []query.ClaimsParams{
+		{AirdropStartTime: airdropStart, DurationUntilDecay: "1 month", DurationOfDecay: "1h"},
+		{AirdropStartTime: airdropStart, DurationUntilDecay: "1h", DurationOfDecay: "0s"},
+		{DurationUntilDecay: "1h", DurationOfDecay: "1h"},
+	} {
+		if _, err := ScheduleFromParams(p); err == nil {
+			t.Errorf("expected an error for params %+v", p)
+		}
+	}
+}
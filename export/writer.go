@@ -0,0 +1,269 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Formats are the supported export formats
+var Formats = []string{"csv", "jsonl", "parquet"}
+
+// Kind is the type a column is exported as
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Bool
+	Time
+)
+
+// Column is an exported column
+type Column struct {
+	Name string
+	Kind Kind
+}
+
+// KindOf returns the kind of a column of the given database type name, as reported by
+// sqlite or postgres. Unknown types, e.g. the ones of expressions, are exported as strings.
+func KindOf(databaseType string) Kind {
+	switch strings.ToUpper(databaseType) {
+	case "INT", "INTEGER", "BIGINT", "INT2", "INT4", "INT8", "SMALLINT":
+		return Int
+	case "BOOL", "BOOLEAN":
+		return Bool
+	case "TIMESTAMP", "TIMESTAMPTZ", "DATETIME", "DATE":
+		return Time
+	default:
+		return String
+	}
+}
+
+// Writer writes the exported rows on a format
+type Writer interface {
+	// Write writes a row with a value per column as scanned from the database
+	Write(values []interface{}) error
+	// Close flushes the rows written, it does not close the underlying writer
+	Close() error
+}
+
+// NewWriter returns the writer of the format, csv and parquet write the column names first
+func NewWriter(format string, w io.Writer, columns []Column) (Writer, error) {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		names := make([]string, len(columns))
+		for i, c := range columns {
+			names[i] = c.Name
+		}
+		if err := cw.Write(names); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw, columns: columns}, nil
+	case "jsonl":
+		return &jsonWriter{enc: json.NewEncoder(w), columns: columns}, nil
+	case "parquet":
+		return newParquetWriter(w, columns)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected one of %v", format, strings.Join(Formats, ", "))
+	}
+}
+
+// timeLayouts are the layouts of the times stored as text by sqlite
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// value converts a value scanned from the database to the kind of its column,
+// nil stays nil and times are UTC
+func value(c Column, v interface{}) (interface{}, error) {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	switch c.Kind {
+	case Int:
+		switch n := v.(type) {
+		case int64:
+			return n, nil
+		case string:
+			i, err := strconv.ParseInt(n, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("column %v: %q is not an integer", c.Name, n)
+			}
+			return i, nil
+		}
+	case Bool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case int64:
+			return b != 0, nil
+		}
+	case Time:
+		switch t := v.(type) {
+		case time.Time:
+			return t.UTC(), nil
+		case string:
+			for _, layout := range timeLayouts {
+				if parsed, err := time.Parse(layout, t); err == nil {
+					return parsed.UTC(), nil
+				}
+			}
+			return nil, fmt.Errorf("column %v: %q is not a time", c.Name, t)
+		}
+	}
+	switch s := v.(type) {
+	case string:
+		if c.Kind == String {
+			return s, nil
+		}
+	case time.Time:
+		return s.UTC().Format(time.RFC3339Nano), nil
+	default:
+		if c.Kind == String {
+			return fmt.Sprint(s), nil
+		}
+	}
+	return nil, fmt.Errorf("column %v: unexpected value %v of type %T", c.Name, v, v)
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []Column
+}
+
+func (w *csvWriter) Write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		v, err := value(w.columns[i], v)
+		if err != nil {
+			return err
+		}
+		switch v := v.(type) {
+		case nil:
+		case time.Time:
+			record[i] = v.Format(time.RFC3339Nano)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return w.w.Write(record)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type jsonWriter struct {
+	enc     *json.Encoder
+	columns []Column
+}
+
+// Write writes the row as a json object, keys keep the order of the columns
+func (w *jsonWriter) Write(values []interface{}) error {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, v := range values {
+		v, err := value(w.columns[i], v)
+		if err != nil {
+			return err
+		}
+		key, _ := json.Marshal(w.columns[i].Name)
+		val, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(val)
+	}
+	b.WriteString("}")
+	return w.enc.Encode(json.RawMessage(b.String()))
+}
+
+func (w *jsonWriter) Close() error {
+	return nil
+}
+
+type parquetWriter struct {
+	w       *writer.CSVWriter
+	columns []Column
+}
+
+// newParquetWriter returns a writer of a parquet file with an optional field per column,
+// times are stored as milliseconds timestamps
+func newParquetWriter(w io.Writer, columns []Column) (*parquetWriter, error) {
+	md := make([]string, len(columns))
+	for i, c := range columns {
+		if !isIdentifier(c.Name) {
+			return nil, fmt.Errorf("column %q can not be a parquet field, select it with an alias", c.Name)
+		}
+		switch c.Kind {
+		case Int:
+			md[i] = fmt.Sprintf("name=%v, type=INT64, repetitiontype=OPTIONAL", c.Name)
+		case Bool:
+			md[i] = fmt.Sprintf("name=%v, type=BOOLEAN, repetitiontype=OPTIONAL", c.Name)
+		case Time:
+			md[i] = fmt.Sprintf("name=%v, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL", c.Name)
+		default:
+			md[i] = fmt.Sprintf("name=%v, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL", c.Name)
+		}
+	}
+	pw, err := writer.NewCSVWriterFromWriter(md, w, 1)
+	if err != nil {
+		return nil, fmt.Errorf("error creating parquet writer: %v", err)
+	}
+	return &parquetWriter{w: pw, columns: columns}, nil
+}
+
+func (w *parquetWriter) Write(values []interface{}) error {
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		v, err := value(w.columns[i], v)
+		if err != nil {
+			return err
+		}
+		if t, ok := v.(time.Time); ok {
+			v = t.UnixMilli()
+		}
+		row[i] = v
+	}
+	return w.w.Write(row)
+}
+
+func (w *parquetWriter) Close() error {
+	return w.w.WriteStop()
+}
+
+// isIdentifier returns whether name is made of letters, digits and underscores only
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := map[string]Kind{
+		"INTEGER":     Int,
+		"int8":        Int,
+		"BOOLEAN":     Bool,
+		"TIMESTAMPTZ": Time,
+		"timestamp":   Time,
+		"TEXT":        String,
+		"NUMERIC":     String,
+		"":            String,
+	}
+	for databaseType, want := range tests {
+		if got := KindOf(databaseType); got != want {
+			t.Errorf("KindOf(%q) = %v, want %v", databaseType, got, want)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	utc := time.Date(2022, 4, 27, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		kind Kind
+		in   interface{}
+		want interface{}
+	}{
+		{"nil", Int, nil, nil},
+		{"int", Int, int64(42), int64(42)},
+		{"int from text", Int, "42", int64(42)},
+		{"int from bytes", Int, []byte("-7"), int64(-7)},
+		{"bool", Bool, true, true},
+		{"bool from sqlite integer", Bool, int64(0), false},
+		{"time", Time, utc.In(time.FixedZone("CEST", 2*3600)), utc},
+		{"time from sqlite text", Time, "2022-04-27 12:30:00+00:00", utc},
+		{"time from sqlite text without zone", Time, "2022-04-27T12:30:00", utc},
+		{"time from bytes", Time, []byte("2022-04-27 12:30:00"), utc},
+		{"string", String, "evmos1a", "evmos1a"},
+		{"string from bytes", String, []byte("1.000000000000000001"), "1.000000000000000001"},
+		{"string from number", String, int64(5), "5"},
+		{"string from float", String, 1.5, "1.5"},
+		{"string from time", String, utc, "2022-04-27T12:30:00Z"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := value(Column{Name: "c", Kind: tc.kind}, tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotTime, ok := got.(time.Time); ok {
+				if !gotTime.Equal(tc.want.(time.Time)) || gotTime.Location() != time.UTC {
+					t.Errorf("got %v, want %v in UTC", gotTime, tc.want)
+				}
+				return
+			}
+			if got != tc.want {
+				t.Errorf("got %v (%T), want %v (%T)", got, got, tc.want, tc.want)
+			}
+		})
+	}
+}
+
+func TestValueErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		kind Kind
+		in   interface{}
+	}{
+		{"int from text", Int, "4.2"},
+		{"int from bool", Int, true},
+		{"bool from text", Bool, "true"},
+		{"time from text", Time, "yesterday"},
+		{"time from integer", Time, int64(1651062600)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := value(Column{Name: "c", Kind: tc.kind}, tc.in); err == nil {
+				t.Errorf("got %v, want an error", got)
+			}
+		})
+	}
+}
+
+var testColumns = []Column{{"height", Int}, {"sender", String}, {"resolved", Bool}, {"block_time", Time}}
+
+func writeRows(t *testing.T, format string, rows ...[]interface{}) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w, err := NewWriter(format, &b, testColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestWriters(t *testing.T) {
+	rows := [][]interface{}{
+		{int64(10), []byte("evmos1a"), int64(1), "2022-04-27 12:30:00+00:00"},
+		{"11", nil, false, nil},
+	}
+
+	csv := string(writeRows(t, "csv", rows...))
+	if want := "height,sender,resolved,block_time\n10,evmos1a,true,2022-04-27T12:30:00Z\n11,,false,\n"; csv != want {
+		t.Errorf("got csv %q, want %q", csv, want)
+	}
+
+	jsonl := string(writeRows(t, "jsonl", rows...))
+	want := `{"height":10,"sender":"evmos1a","resolved":true,"block_time":"2022-04-27T12:30:00Z"}` + "\n" +
+		`{"height":11,"sender":null,"resolved":false,"block_time":null}` + "\n"
+	if jsonl != want {
+		t.Errorf("got jsonl %q, want %q", jsonl, want)
+	}
+
+	parquet := writeRows(t, "parquet", rows...)
+	if len(parquet) < 8 || string(parquet[:4]) != "PAR1" || string(parquet[len(parquet)-4:]) != "PAR1" {
+		t.Errorf("got %v bytes that are not a parquet file", len(parquet))
+	}
+}
+
+func TestNewWriterErrors(t *testing.T) {
+	var b bytes.Buffer
+	if _, err := NewWriter("xml", &b, testColumns); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, err := NewWriter("parquet", &b, []Column{{"count(*)", Int}}); err == nil {
+		t.Error("expected an error for a column that is not a parquet field")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/facs95/decay-data/config"
+)
+
+// flagSet is a command flag set that loads the config and overrides it with the flags
+type flagSet struct {
+	*flag.FlagSet
+	configPath string
+	rpc        string
+	// decayLog is whether the --log flag sets the decay log path instead of the log path
+	decayLog bool
+	values   config.Config
+}
+
+// newFlagSet returns the flag set of a command registering the --config flag
+// and a flag for each of the given settings
+func newFlagSet(name, args, description string, settings ...string) *flagSet {
+	fs := &flagSet{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+	def := config.Default()
+
+	fs.StringVar(&fs.configPath, "config", "", fmt.Sprintf("path to the yaml config file, %v is used if it exists (env DECAY_CONFIG)", config.DefaultPath))
+	for _, setting := range settings {
+		switch setting {
+		case "db":
+			fs.StringVar(&fs.values.DBPath, "db", def.DBPath, "path to the sqlite database, or a postgres:// connection url (env DECAY_DB_PATH)")
+		case "log":
+			fs.StringVar(&fs.values.LogPath, "log", def.LogPath, "path to the log file (env DECAY_LOG_PATH)")
+		case "decay-log":
+			fs.StringVar(&fs.values.DecayLogPath, "log", def.DecayLogPath, "path to the log file (env DECAY_DECAY_LOG_PATH)")
+			fs.decayLog = true
+		case "genesis":
+			fs.StringVar(&fs.values.GenesisPath, "genesis", def.GenesisPath, "path to the genesis file (env DECAY_GENESIS_PATH)")
+		case "rpc":
+			fs.StringVar(&fs.rpc, "rpc", strings.Join(def.RPCEndpoints, ","), "comma separated list of tendermint rpc endpoints (env DECAY_RPC_ENDPOINTS)")
+			fs.IntVar(&fs.values.RPCMaxAttempts, "rpc-max-attempts", def.RPCMaxAttempts, "attempts per block before giving up (env DECAY_RPC_MAX_ATTEMPTS)")
+		case "blocks-dir":
+			fs.StringVar(&fs.values.BlocksDir, "blocks-dir", def.BlocksDir, "read block results from <height>.json and headers from <height>.block.json files in this directory instead of the rpc endpoints (env DECAY_BLOCKS_DIR)")
+		case "batch-size":
+			fs.IntVar(&fs.values.BatchSize, "batch-size", def.BatchSize, "amount of items per job (env DECAY_BATCH_SIZE)")
+		case "precision":
+			fs.IntVar(&fs.values.DisplayPrecision, "precision", def.DisplayPrecision, "decimals of the evmos amounts on reports (env DECAY_DISPLAY_PRECISION)")
+		case "reimbursement":
+			fs.StringVar(&fs.values.ReimbursementFrom, "from-address", def.ReimbursementFrom, "address paying the reimbursements (env DECAY_REIMBURSEMENT_FROM)")
+			fs.IntVar(&fs.values.ReimbursementChunkSize, "chunk-size", def.ReimbursementChunkSize, "payments per multi-send transaction (env DECAY_REIMBURSEMENT_CHUNK_SIZE)")
+			fs.StringVar(&fs.values.ReimbursementDust, "dust", def.ReimbursementDust, "losses up to this amount of the claims denom are not reimbursed (env DECAY_REIMBURSEMENT_DUST)")
+			fs.StringVar(&fs.values.ReimbursementDir, "out", def.ReimbursementDir, "directory the transactions and manifest are written to (env DECAY_REIMBURSEMENT_DIR)")
+		case "workers":
+			fs.IntVar(&fs.values.MaxWorkers, "workers", def.MaxWorkers, "amount of concurrent workers (env DECAY_MAX_WORKERS)")
+		default:
+			panic(fmt.Sprintf("unknown setting %q", setting))
+		}
+	}
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: decay-data %v [flags] %v\n\n%v\n\nFlags:\n", name, args, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// load parses the arguments and returns the config file settings
+// overridden by the environment and then by the flags provided
+func (fs *flagSet) load(args []string) (config.Config, error) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return config.Config{}, err
+		}
+		return config.Config{}, errUsage
+	}
+
+	path := fs.configPath
+	if path == "" {
+		path = os.Getenv("DECAY_CONFIG")
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "db":
+			cfg.DBPath = fs.values.DBPath
+		case "log":
+			if fs.decayLog {
+				cfg.DecayLogPath = fs.values.DecayLogPath
+			} else {
+				cfg.LogPath = fs.values.LogPath
+			}
+		case "genesis":
+			cfg.GenesisPath = fs.values.GenesisPath
+		case "rpc":
+			cfg.RPCEndpoints = config.SplitList(fs.rpc)
+		case "rpc-max-attempts":
+			cfg.RPCMaxAttempts = fs.values.RPCMaxAttempts
+		case "blocks-dir":
+			cfg.BlocksDir = fs.values.BlocksDir
+		case "batch-size":
+			cfg.BatchSize = fs.values.BatchSize
+		case "workers":
+			cfg.MaxWorkers = fs.values.MaxWorkers
+		case "precision":
+			cfg.DisplayPrecision = fs.values.DisplayPrecision
+		case "from-address":
+			cfg.ReimbursementFrom = fs.values.ReimbursementFrom
+		case "chunk-size":
+			cfg.ReimbursementChunkSize = fs.values.ReimbursementChunkSize
+		case "dust":
+			cfg.ReimbursementDust = fs.values.ReimbursementDust
+		case "out":
+			cfg.ReimbursementDir = fs.values.ReimbursementDir
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, fs.usageErr("%v", err)
+	}
+	return cfg, nil
+}
+
+// loadNoArgs is load for commands that take no positional arguments
+func (fs *flagSet) loadNoArgs(args []string) (config.Config, error) {
+	cfg, err := fs.load(args)
+	if err != nil {
+		return cfg, err
+	}
+	if fs.NArg() != 0 {
+		return cfg, fs.usageErr("unexpected arguments %v", fs.Args())
+	}
+	return cfg, nil
+}
+
+// usageErr prints the error with the command usage and returns errUsage
+func (fs *flagSet) usageErr(format string, args ...interface{}) error {
+	fmt.Fprintf(fs.Output(), "error: "+format+"\n\n", args...)
+	fs.Usage()
+	return errUsage
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlagSetLogPath(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("log_path: output.log\ndecay_log_path: decay.log\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		setting       string
+		args          []string
+		log, decayLog string
+	}{
+		{"log not set", "log", nil, "output.log", "decay.log"},
+		{"log", "log", []string{"-log", "other.log"}, "other.log", "decay.log"},
+		{"decay log not set", "decay-log", nil, "output.log", "decay.log"},
+		{"decay log", "decay-log", []string{"-log", "other.log"}, "output.log", "other.log"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := newFlagSet("test", "", "", "db", tc.setting)
+			cfg, err := fs.load(append([]string{"-config", configPath}, tc.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.LogPath != tc.log || cfg.DecayLogPath != tc.decayLog {
+				t.Errorf("got log %q and decay log %q, want %q and %q", cfg.LogPath, cfg.DecayLogPath, tc.log, tc.decayLog)
+			}
+		})
+	}
+}
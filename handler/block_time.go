@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/query"
+)
+
+// blockTimes looks up the time of a block on the block_time table
+// before querying it from the source
+type blockTimes struct {
+	store  blockTimeStore
+	source query.BlockTimeSource
+}
+
+// get returns the time of the block at height and whether it was already cached
+func (b blockTimes) get(ctx context.Context, height int) (time.Time, bool, error) {
+	t, cached, err := b.store.BlockTime(ctx, height)
+	if err != nil || cached {
+		return t, cached, err
+	}
+	t, err = b.source.GetBlockTime(ctx, height)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t, false, nil
+}
+
+// stampEvents attaches the time of a block to its events, returning the
+// block time to cache when there were events and the time was not cached yet
+func (b blockTimes) stampEvents(ctx context.Context, height int, merged []dblib.MergedEvent, claims []dblib.ClaimEvent) ([]dblib.BlockTime, error) {
+	if len(merged) == 0 && len(claims) == 0 {
+		return nil, nil
+	}
+	t, cached, err := b.get(ctx, height)
+	if err != nil {
+		return nil, fmt.Errorf("error querying block time: %v", err)
+	}
+	for i := range merged {
+		merged[i].BlockTime = t
+	}
+	for i := range claims {
+		claims[i].BlockTime = t
+	}
+	if cached {
+		return nil, nil
+	}
+	return []dblib.BlockTime{{Height: height, Time: t}}, nil
+}
@@ -3,275 +3,341 @@ package handler
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"math/big"
-	"os"
-	"strings"
+	"sync"
 
+	"github.com/facs95/decay-data/address"
+	"github.com/facs95/decay-data/coin"
+	"github.com/facs95/decay-data/config"
 	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/decay"
 	"github.com/facs95/decay-data/query"
 )
 
-func DecayLostAmounts() {
-	// Set up database connection
-	db, err := sql.Open("sqlite3", "./accounts.db")
-	if err != nil {
-		log.Fatalf("error opening database connection: %v", err)
-	}
-	defer db.Close()
-
-	// Create en databases
-	dblib.CreateDecayAmountTable(db)
+// DecayLostAmounts calculates the amount lost by every account on the claim_event table
+// and by every recipient of the merged_event table.
+// Each claim is reconstructed at its block time under the correct and buggy decay schedules.
+func DecayLostAmounts(cfg config.Config, source query.BlockTimeSource) {
+	// Log to a file to have persistent logs and open the migrated database
+	db, closeAll := setup(cfg, cfg.DecayLogPath)
+	defer closeAll()
 
-	// Set up context with cancellation
-	ctx, cancel := context.WithCancel(context.Background())
+	// Set up context cancelled on shutdown signals
+	ctx, stop, cancel := withShutdown()
 	defer cancel()
 
 	// Process the range in batches
-	if err := handleProcesses(ctx, db); err != nil {
+	if err := handleProcesses(ctx, stop, db, cfg, source); err != nil {
 		log.Fatalf("error processing range: %v", err)
 	}
 }
 
-func handleProcesses(ctx context.Context, db *sql.DB) error {
-	// Create a log file to have persistent logs
-	logFile, err := os.OpenFile("./decay_loss_output.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+func handleProcesses(ctx context.Context, stop <-chan struct{}, db decayStore, cfg config.Config, source query.BlockTimeSource) error {
+	// The claims params and records are imported from genesis by import-genesis
+	params, err := getClaimsParams(ctx, db)
 	if err != nil {
-		log.Fatalf("error opening file: %v", err)
+		return err
 	}
-	defer logFile.Close()
 
-	wrt := io.MultiWriter(os.Stdout, logFile)
-	log.SetOutput(wrt)
-
-	// Collect claim records from genesis
-	content, err := os.ReadFile("genesis.json")
+	model, err := newDecayModel(params, cfg)
 	if err != nil {
-		log.Fatalf("Error reading the genesis: %q", err)
+		return fmt.Errorf("error loading decay schedule: %v", err)
 	}
 
-	var genesis query.Genesis
-	err = json.Unmarshal(content, &genesis)
+	err = backfillBlockTimes(ctx, stop, db, source, cfg.MaxWorkers)
 	if err != nil {
-		log.Fatal("Error unmarshalling genesis: ", err)
+		return fmt.Errorf("error querying block times: %v", err)
 	}
-
-	// For each account get its info
-	rows, err := db.Query("select id, sender, height, amount, claim_action from claim_event order by id")
-	if err != nil {
-		log.Fatal("Error reading genesis addresses: ", err)
+	if stopped(stop) {
+		logSummary("interrupted while querying block times, no decay amounts were stored")
+		return nil
 	}
 
-	// Get all accounts from genesis on a map
-	// Maybe add this to a database so I dont have to do this over and over again
-	genesisClaimRecords := make(map[string]query.ClaimsRecord)
-	log.Println("creating map of genesis records...")
-	for _, v := range genesis.AppState.Claims.ClaimsRecords {
-		genesisClaimRecords[v.Address] = v
-	}
-	log.Println("finished creating map of genesis records...")
+	accumulator := decay.NewAccumulator(model)
 
+	// For each account get its info along with its genesis claims record
 	log.Println("starting to process rows...")
-	decayAmounts := make(map[string]dblib.DecayAmount)
-	for rows.Next() {
-		var sender string
-		var height string
-		var id int
-		var claimAction string
-		var amount string
-		err := rows.Scan(&id, &sender, &height, &amount, &claimAction)
-		if err != nil {
-			log.Printf("Error getting row: %v", err)
-			continue
+	processedRows := 0
+	err = db.ForEachClaimEvent(ctx, func(e dblib.ClaimEvent, initialClaimable string) error {
+		// Partial results are never stored
+		if stopped(stop) {
+			return errStopped
 		}
-		// create a substring by removing a word "aevmos" from string
-		parsedAmount := strings.Replace(amount, "aevmos", "", 1)
-
-		addressToChange, ok := decayAmounts[sender]
-		if ok {
-			doubleClaim := false
-			switch claimAction {
-			case "ACTION_VOTE":
-				doubleClaim = addressToChange.VoteAction != ""
-				addressToChange.VoteAction = parsedAmount
-			case "ACTION_DELEGATE":
-				doubleClaim = addressToChange.DelegateAction != ""
-				addressToChange.DelegateAction = parsedAmount
-			case "ACTION_EVM":
-				doubleClaim = addressToChange.EVMAction != ""
-				addressToChange.EVMAction = parsedAmount
-			case "ACTION_IBC_TRANSFER":
-				doubleClaim = addressToChange.IBCAction != ""
-				addressToChange.IBCAction = parsedAmount
-			}
-			if doubleClaim {
-				log.Printf("Double claim for address %s", sender)
-			}
+		processedRows++
 
-			//update total claimed
-			amountBig := big.NewInt(0)
-			amountBig, ok = amountBig.SetString(parsedAmount, 10)
-			if !ok {
-				log.Printf("Error converting amount to big int for address %s", sender)
-				continue
-			}
+		if e.BlockTime.IsZero() {
+			log.Printf("Error getting row: claim event %v has no block time", e.ID)
+			return nil
+		}
+		// amounts are stored as integers of the claims denom
+		amountBig, ok := new(big.Int).SetString(e.Amount, 10)
+		if !ok {
+			log.Printf("Error converting amount to big int for address %s", e.Sender)
+			return nil
+		}
 
-			claimRecord, ok := genesisClaimRecords[sender]
-			if !ok {
-				log.Printf("Address %s not found in genesis to calculate losses", sender)
-				continue
-			}
+		event := decay.Event{
+			Sender:    e.Sender,
+			Action:    e.Action,
+			Amount:    amountBig,
+			BlockTime: e.BlockTime,
+		}
+		if initialClaimable != "" {
+			// amounts are validated by import-genesis
+			event.InitialClaimable, _ = new(big.Int).SetString(initialClaimable, 10)
+		}
 
-			totalClaimable, err := calculateTotalClaimable(amountBig, addressToChange.TotalClaimed)
-			if err != nil {
-				log.Printf("Error calculating total claimable for address %s: %v", sender, err)
-			}
+		anomalies := accumulator.Add(event)
+		if anomalies != 0 {
+			log.Printf("claim event %v of %s at height %v: %v", e.ID, e.Sender, e.Height, anomalies)
+		}
+		return nil
+	})
+	if err == errStopped {
+		logSummary("interrupted after processing %v claim events, no decay amounts were stored", processedRows)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading claim events: %v", err)
+	}
 
-			totalLost, err := calculateLost(amountBig, claimRecord.InialClaimableAmount)
-			if err != nil {
-				log.Printf("Error calculating total lost for address %s: %v", sender, err)
-			}
+	// Merged claims records are attributed to their recipient
+	processedMerges, err := accumulateMerges(ctx, stop, db, accumulator)
+	if err != nil {
+		return fmt.Errorf("error reading merged events: %v", err)
+	}
+	if stopped(stop) {
+		logSummary("interrupted after processing %v merged events, no decay amounts were stored", processedMerges)
+		return nil
+	}
 
-			addressToChange.TotalClaimed = totalClaimable
-			addressToChange.TotalLost = totalLost
+	log.Println("Finished going through all the addresses")
 
-			totalLostEvmos, err := calculateTotalLostEvmos(totalLost)
-			if err != nil {
-				log.Printf("Error calculating total lost evmos for address %s: %v", sender, err)
-			}
-			addressToChange.TotalLostEvmos = totalLostEvmos
-		} else {
-			claimRecord, ok := genesisClaimRecords[sender]
-			if !ok {
-				log.Printf("Address %s not found in genesis to calculate losses", sender)
-			}
+	decayAmounts := []dblib.DecayAmount{}
+	totalLost := coin.ZeroDec()
+	for _, account := range accumulator.Accounts() {
+		d := newDecayAmount(account)
+		decayAmounts = append(decayAmounts, d)
+		totalLost = totalLost.Add(d.TotalLostEvmos)
+	}
 
-			addressToChange = dblib.DecayAmount{
-				Sender:                 sender,
-				TotalClaimed:           parsedAmount,
-				InitialClaimableAmount: claimRecord.InialClaimableAmount,
-			}
+	err = db.UpsertDecayAmounts(ctx, decayAmounts)
+	if err != nil {
+		return fmt.Errorf("error storing decay amounts: %v", err)
+	}
+	logSummary("processed %v claim events and %v merged events, stored %v decay amounts losing %v evmos in total",
+		processedRows, processedMerges, len(decayAmounts), totalLost.Format(cfg.DisplayPrecision))
 
-			switch claimAction {
-			case "ACTION_VOTE":
-				addressToChange.VoteAction = parsedAmount
-			case "ACTION_DELEGATE":
-				addressToChange.DelegateAction = parsedAmount
-			case "ACTION_EVM":
-				addressToChange.EVMAction = parsedAmount
-			case "ACTION_IBC_TRANSFER":
-				addressToChange.IBCAction = parsedAmount
-			}
+	// create a tx and submit it to the db
+	return nil
+}
 
-			// Calculate the losses
-			amountBig := big.NewInt(0)
-			amountBig, ok = amountBig.SetString(parsedAmount, 10)
-			if !ok {
-				log.Printf("Error converting amount to big int for address %s", sender)
-				continue
-			}
-			totalLost, err := calculateLost(amountBig, claimRecord.InialClaimableAmount)
-			if err != nil {
-				log.Printf("Error calculating total lost for address %s: %v", sender, err)
-			}
-			addressToChange.TotalLost = totalLost
+// accumulateMerges adds every merged event to its recipient account. The genesis claims
+// record of the merge is the one of the IBC sender converted to the recipient prefix.
+func accumulateMerges(ctx context.Context, stop <-chan struct{}, db decayStore, accumulator *decay.Accumulator) (int, error) {
+	merges := []decay.Merge{}
+	ids := []int{}
+	err := db.ForEachMergedEvent(ctx, func(e dblib.MergedEvent) error {
+		claimedBig, ok := new(big.Int).SetString(e.ClaimedCoins, 10)
+		if !ok {
+			log.Printf("Error converting claimed coins of merged event %v to big int", e.ID)
+			return nil
+		}
+		communityPoolBig, ok := new(big.Int).SetString(e.FundCommunityPool, 10)
+		if !ok {
+			log.Printf("Error converting community pool coins of merged event %v to big int", e.ID)
+			return nil
+		}
+		merges = append(merges, decay.Merge{
+			Recipient:     e.Recipient,
+			Sender:        e.Sender,
+			Claimed:       claimedBig,
+			CommunityPool: communityPoolBig,
+			BlockTime:     e.BlockTime,
+		})
+		ids = append(ids, e.ID)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
 
-			totalLostEvmos, err := calculateTotalLostEvmos(totalLost)
+	for i, m := range merges {
+		// Partial results are never stored
+		if stopped(stop) {
+			return i, nil
+		}
+		if m.Sender != "" {
+			initial, err := senderInitialClaimable(ctx, db, m.Sender, m.Recipient)
 			if err != nil {
-				log.Printf("Error calculating total lost evmos for address %s: %v", sender, err)
+				log.Printf("merged event %v: %v", ids[i], err)
 			}
-			addressToChange.TotalLostEvmos = totalLostEvmos
+			m.InitialClaimable = initial
+		}
+		if anomalies := accumulator.AddMerge(m); anomalies != 0 {
+			log.Printf("merged event %v of %s to %s: %v", ids[i], m.Sender, m.Recipient, anomalies)
 		}
-
-		decayAmounts[sender] = addressToChange
 	}
+	return len(merges), nil
+}
 
-	log.Println("Finished going through all the addresses")
-
-	rows.Close()
-	err = insertIntoDatabase(ctx, db, decayAmounts)
+// senderInitialClaimable returns the genesis initial claimable amount of the merge sender, nil if it has none
+func senderInitialClaimable(ctx context.Context, db claimsStore, sender, recipient string) (*big.Int, error) {
+	prefix, err := address.Prefix(recipient)
 	if err != nil {
-		log.Fatalf("Error inserting into db: %v", err)
+		return nil, fmt.Errorf("invalid recipient: %v", err)
+	}
+	converted, err := address.ConvertPrefix(sender, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %v", err)
 	}
 
-	// create a tx and submit it to the db
-	return nil
-}
-
-func calculateTotalLostEvmos(totalLost string) (float64, error) {
-	if totalLost == "" {
-		return 0, fmt.Errorf("total lost is empty")
+	record, err := db.ClaimsRecord(ctx, converted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
-	floatLost := big.NewFloat(0)
-	floatLost, ok := floatLost.SetString(totalLost)
+	amount, ok := new(big.Int).SetString(record.InitialClaimableAmount, 10)
 	if !ok {
-		return 0, fmt.Errorf("Error converting amount to big float")
+		return nil, fmt.Errorf("invalid initial claimable amount %q of %v", record.InitialClaimableAmount, converted)
 	}
-	reducedBig := big.NewInt(0)
-	reducedBig.Exp(big.NewInt(10), big.NewInt(18), nil)
-	floatLost = floatLost.Quo(floatLost, big.NewFloat(0).SetInt(reducedBig))
-	am, _ := floatLost.Float64()
-	return am, nil
+	return amount, nil
 }
 
-// calculateLost calculates the amount lost by action
-func calculateLost(amountClaimed *big.Int, initialClaimableAmount string) (string, error) {
-	if initialClaimableAmount == "" {
-		return "", fmt.Errorf("initial claimable amount is empty")
+// newDecayAmount returns the decay_amount row of an accumulated account
+func newDecayAmount(account *decay.Account) dblib.DecayAmount {
+	d := dblib.DecayAmount{
+		Sender:         account.Sender,
+		VoteAction:     amountString(account.Actions[decay.ActionVote]),
+		DelegateAction: amountString(account.Actions[decay.ActionDelegate]),
+		EVMAction:      amountString(account.Actions[decay.ActionEVM]),
+		IBCAction:      amountString(account.Actions[decay.ActionIBCTransfer]),
+		MergedClaimed:  account.MergedClaimed.String(),
+		CommunityPool:  account.CommunityPool.String(),
+		TotalClaimed:   account.TotalClaimed.String(),
+		TotalLost:      account.TotalLost.String(),
+		TotalLostEvmos: coin.NewDecFromAtto(account.TotalLost),
+		Anomalies:      account.Anomalies.String(),
 	}
-	claimableAmountBig := big.NewInt(0)
-	claimableAmountBig, ok := claimableAmountBig.SetString(initialClaimableAmount, 10)
-	if !ok {
-		return "", fmt.Errorf("Error converting initial claimable amount to big int")
+	if account.InitialClaimable != nil {
+		d.InitialClaimableAmount = account.InitialClaimable.String()
 	}
-
-	// calculate the expected amount to claim per action
-	expectedAmountToClaimPerAction := claimableAmountBig.Div(claimableAmountBig, big.NewInt(4))
-	// calculate the difference between the expected amount and the actual amount
-	lostAmountBig := expectedAmountToClaimPerAction.Sub(expectedAmountToClaimPerAction, amountClaimed)
-	return lostAmountBig.String(), nil
+	return d
 }
 
-// calculateTotalClaimable calculates the total claimable amount
-func calculateTotalClaimable(amountClaimed *big.Int, totalAmountClaimed string) (string, error) {
-	totalClaimedBig := big.NewInt(0)
-	totalClaimedBig, ok := totalClaimedBig.SetString(totalAmountClaimed, 10)
-	if !ok {
-		return "", fmt.Errorf("Error converting total claimed to big int for amount %v", totalAmountClaimed)
+// amountString returns the amount or an empty string for actions not claimed
+func amountString(amount *big.Int) string {
+	if amount == nil {
+		return ""
 	}
-	totalClaimedBig = totalClaimedBig.Add(totalClaimedBig, amountClaimed)
-	return totalClaimedBig.String(), nil
+	return amount.String()
 }
 
-func insertIntoDatabase(ctx context.Context, db *sql.DB, decayAmounts map[string]dblib.DecayAmount) error {
-	//Create a transaction on the database
-	tx, err := db.BeginTx(ctx, nil)
+// newDecayModel returns the loss model of the genesis claims params with the configured overrides
+func newDecayModel(params query.ClaimsParams, cfg config.Config) (decay.Model, error) {
+	genesisSchedule, err := decay.ScheduleFromParams(params)
 	if err != nil {
-		return fmt.Errorf("error starting transaction: %v", err)
+		return decay.Model{}, err
 	}
-	defer tx.Rollback()
 
-	stmt1, err := dblib.PrepareInsertDecayAmountQuery(ctx, tx)
-	if err != nil {
-		return fmt.Errorf("error preparing statement for Table1: %v", err)
+	model := decay.Model{Correct: overrideSchedule(genesisSchedule, cfg.CorrectSchedule)}
+	if err := model.Correct.Validate(); err != nil {
+		return decay.Model{}, fmt.Errorf("correct schedule: %v", err)
 	}
-	defer stmt1.Close()
-
-	for _, d := range decayAmounts {
-		err := dblib.ExecContextDecayAmount(ctx, stmt1, d)
-		if err != nil {
-			return fmt.Errorf("error inserting data into Table1: %v", err)
+	if cfg.BuggySchedule != nil {
+		buggy := overrideSchedule(genesisSchedule, cfg.BuggySchedule)
+		if err := buggy.Validate(); err != nil {
+			return decay.Model{}, fmt.Errorf("buggy schedule: %v", err)
 		}
+		model.Buggy = &buggy
+	}
+	log.Printf("correct schedule: %+v", model.Correct)
+	if model.Buggy != nil {
+		log.Printf("buggy schedule: %+v", *model.Buggy)
+	}
+	return model, nil
+}
+
+// overrideSchedule replaces the schedule values that are set on the override
+func overrideSchedule(s decay.Schedule, override *config.ScheduleOverride) decay.Schedule {
+	if override == nil {
+		return s
+	}
+	if !override.AirdropStartTime.IsZero() {
+		s.AirdropStartTime = override.AirdropStartTime
+	}
+	if override.DurationUntilDecay != 0 {
+		s.DurationUntilDecay = override.DurationUntilDecay
+	}
+	if override.DurationOfDecay != 0 {
+		s.DurationOfDecay = override.DurationOfDecay
 	}
+	return s
+}
 
-	// Commit the transaction
-	err = tx.Commit()
+// backfillBlockTimes attaches the block time to the claim and merged events stored without it,
+// looking them up on the block_time table before querying the source. The times found are
+// stored even when some heights fail, so the next run only queries the failed ones.
+func backfillBlockTimes(ctx context.Context, stop <-chan struct{}, db decayStore, source query.BlockTimeSource, maxWorkers int) error {
+	heights, err := db.HeightsWithoutBlockTime(ctx)
 	if err != nil {
-		return fmt.Errorf("error committing transaction: %v", err)
+		return err
+	}
+	if len(heights) == 0 {
+		return nil
+	}
+	log.Printf("querying the time of %v blocks...", len(heights))
+
+	times := blockTimes{store: db, source: source}
+	found := []dblib.BlockTime{}
+	var mu sync.Mutex
+	var firstErr error
+	failed := 0
+
+	jobs := make(chan int, maxWorkers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < maxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for height := range jobs {
+				blockTime, _, err := times.get(ctx, height)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					failed++
+				} else {
+					found = append(found, dblib.BlockTime{Height: height, Time: blockTime})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, height := range heights {
+		select {
+		case jobs <- height:
+		case <-stop:
+		}
+		if stopped(stop) {
+			break
+		}
 	}
+	close(jobs)
+	wg.Wait()
 
+	if err := db.SetEventBlockTimes(ctx, found); err != nil {
+		return err
+	}
+	if firstErr != nil {
+		return fmt.Errorf("%v of %v heights failed, stored the time of %v: %v", failed, len(heights), len(found), firstErr)
+	}
 	return nil
 }
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/facs95/decay-data/address"
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+)
+
+var airdropStart = time.Date(2022, 4, 27, 0, 0, 0, 0, time.UTC)
+
+func TestBackfillBlockTimes(t *testing.T) {
+	db := newFakeStore()
+	db.blockTimes[10] = airdropStart
+	db.claims = []dblib.ClaimEvent{{ID: 1, Height: 10}, {ID: 2, Height: 11}, {ID: 3, Height: 12}}
+	db.merged = []dblib.MergedEvent{{ID: 1, Height: 11}}
+	source := fakeBlockTimes{11: airdropStart.Add(time.Hour)}
+
+	err := backfillBlockTimes(context.Background(), make(chan struct{}), db, source, 2)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 heights failed, stored the time of 2") {
+		t.Fatalf("got error %v, want the failed height reported", err)
+	}
+	// The times found are stored even though a height failed
+	if !db.claims[0].BlockTime.Equal(airdropStart) || !db.claims[1].BlockTime.Equal(airdropStart.Add(time.Hour)) ||
+		!db.merged[0].BlockTime.Equal(airdropStart.Add(time.Hour)) || !db.claims[2].BlockTime.IsZero() {
+		t.Errorf("got claims %+v and merged %+v", db.claims, db.merged)
+	}
+
+	// The next run only queries the failed height
+	source[12] = airdropStart.Add(2 * time.Hour)
+	if err := backfillBlockTimes(context.Background(), make(chan struct{}), db, source, 2); err != nil {
+		t.Fatal(err)
+	}
+	if heights, _ := db.HeightsWithoutBlockTime(context.Background()); len(heights) != 0 {
+		t.Errorf("got heights %v without block time", heights)
+	}
+}
+
+// decayTestStore returns a store with the genesis of two accounts, the first claiming
+// an action before the decay and one during it, and receiving the merge of the second
+func decayTestStore(t *testing.T) (*fakeStore, string) {
+	t.Helper()
+	recipient := "evmos16t3l6qj8s48cu87yrpfuedevt7u2fl37h95raj"
+	sender := "evmos1mz8ewhmyk62aufnlhwshc9tc5746w9dqltp9yc"
+	ibcSender, err := address.ConvertPrefix(sender, "osmo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newFakeStore()
+	db.params = &dblib.ClaimsParams{
+		EnableClaims:       true,
+		AirdropStartTime:   airdropStart,
+		DurationUntilDecay: "1h",
+		DurationOfDecay:    "4h",
+		ClaimsDenom:        "aevmos",
+	}
+	db.records[recipient] = dblib.ClaimsRecord{Address: recipient, InitialClaimableAmount: "400"}
+	db.records[sender] = dblib.ClaimsRecord{Address: sender, InitialClaimableAmount: "800"}
+	db.claims = []dblib.ClaimEvent{
+		{ID: 1, Sender: recipient, Action: "ACTION_VOTE", Amount: "100", Height: 10, BlockTime: airdropStart.Add(30 * time.Minute)},
+		// Claimed halfway through the decay, when 50 was claimable
+		{ID: 2, Sender: recipient, Action: "ACTION_EVM", Amount: "10", Height: 12},
+	}
+	// A whole action of the sender, when 100 was claimable
+	db.merged = []dblib.MergedEvent{
+		{ID: 1, Recipient: recipient, Sender: ibcSender, ClaimedCoins: "60", FundCommunityPool: "140", Height: 12},
+	}
+	return db, recipient
+}
+
+func TestHandleProcesses(t *testing.T) {
+	db, recipient := decayTestStore(t)
+	source := fakeBlockTimes{12: airdropStart.Add(3 * time.Hour)}
+	cfg := config.Config{MaxWorkers: 2}
+
+	if err := handleProcesses(context.Background(), make(chan struct{}), db, cfg, source); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.decayAmounts) != 1 {
+		t.Fatalf("got decay amounts %+v, want the one of the recipient", db.decayAmounts)
+	}
+	got := db.decayAmounts[0]
+	want := dblib.DecayAmount{
+		Sender:                 recipient,
+		VoteAction:             "100",
+		EVMAction:              "10",
+		MergedClaimed:          "60",
+		CommunityPool:          "140",
+		TotalClaimed:           "170",
+		TotalLost:              "80",
+		InitialClaimableAmount: "400",
+	}
+	if got.TotalLostEvmos.String() != "0.000000000000000080" {
+		t.Errorf("got total lost evmos %v", got.TotalLostEvmos)
+	}
+	got.TotalLostEvmos = want.TotalLostEvmos
+	if got != want {
+		t.Errorf("got decay amount %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleProcessesErrors(t *testing.T) {
+	db, _ := decayTestStore(t)
+	source := fakeBlockTimes{12: airdropStart.Add(3 * time.Hour)}
+	cfg := config.Config{MaxWorkers: 2}
+
+	db.upsertErr = errors.New("disk full")
+	err := handleProcesses(context.Background(), make(chan struct{}), db, cfg, source)
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("got error %v, want the storing error", err)
+	}
+
+	// Nothing is stored once stopped
+	db.upsertErr = nil
+	stop := make(chan struct{})
+	close(stop)
+	if err := handleProcesses(context.Background(), stop, db, cfg, source); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.decayAmounts) != 0 {
+		t.Errorf("got decay amounts %+v stored after stopping", db.decayAmounts)
+	}
+
+	db.params = nil
+	if err := handleProcesses(context.Background(), make(chan struct{}), db, cfg, source); err == nil {
+		t.Error("expected an error without claims params")
+	}
+}
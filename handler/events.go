@@ -2,59 +2,48 @@ package handler
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
-	dblib "github.com/facs95/decay-data/db"
-	"github.com/facs95/decay-data/query"
-	"io"
 	"log"
-	"os"
-	"strconv"
 	"sync"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/query"
 )
 
-const (
-	//FromBlock  = 1026989 // Block from which to start querying
-	//ToBlock    = 1164452 // Last block to query
-	BatchSize  = 1000 // Amount of blocks per thread
-	MaxWorkers = 5    // Amount of threads
-)
+func CollectEvents(cfg config.Config, source query.Source, fromBlock int, toBlock int) {
+	// Log to a file to have persistent logs and open the migrated database
+	db, closeAll := setup(cfg, cfg.LogPath)
+	defer closeAll()
 
-func CollectEvents(fromBlock int, toBlock int) {
-	// Set up database connection
-	db, err := sql.Open("sqlite3", "./accounts.db")
+	filter, err := newEventFilter(cfg.EventRules, cfg.ClaimsDenom)
 	if err != nil {
-		log.Fatalf("error opening database connection: %v", err)
+		log.Fatalf("error loading event rules: %v", err)
 	}
-	defer db.Close()
-
-	// Create en databases
-	dblib.CreateMergedEventTable(db)
-	dblib.CreateClaimEventTable(db)
-	dblib.CreateErrorTable(db)
 
-	// Set up context with cancellation
-	ctx, cancel := context.WithCancel(context.Background())
+	// Set up context cancelled on shutdown signals
+	ctx, stop, cancel := withShutdown()
 	defer cancel()
 
 	// Process the range in batches
-	if err := handleWorkers(ctx, db, fromBlock, toBlock, BatchSize, MaxWorkers); err != nil {
+	if err := handleWorkers(ctx, stop, db, source, filter, fromBlock, toBlock, cfg.BatchSize, cfg.MaxWorkers); err != nil {
 		log.Fatalf("error processing range: %v", err)
 	}
 }
 
-func handleWorkers(ctx context.Context, db *sql.DB, fromBlock, toBlock, batchSize int, maxWorkers int) error {
-	// Create a log file to have persistent logs
-	logFile, err := os.OpenFile("./output.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+func handleWorkers(ctx context.Context, stop <-chan struct{}, db eventStore, source query.Source, filter *eventFilter, fromBlock, toBlock, batchSize int, maxWorkers int) error {
+	// Skip the batches completed on previous runs
+	completed, err := db.CompletedRanges(ctx)
 	if err != nil {
-		log.Fatalf("error opening file: %v", err)
+		return fmt.Errorf("error reading progress: %v", err)
+	}
+	pending := pendingRanges(completed, fromBlock, toBlock)
+	if len(pending) == 0 {
+		log.Printf("all blocks between %v-%v were already processed", fromBlock, toBlock)
 	}
-	defer logFile.Close()
 
-	wrt := io.MultiWriter(os.Stdout, logFile)
-	log.SetOutput(wrt)
+	summary := newRunSummary("blocks")
+	times := blockTimes{store: db, source: source}
 
 	// Create a channel to hold jobs to be executed by workers
 	jobs := make(chan []int, maxWorkers)
@@ -67,180 +56,123 @@ func handleWorkers(ctx context.Context, db *sql.DB, fromBlock, toBlock, batchSiz
 		go func(i int) {
 			defer wg.Done()
 			for job := range jobs {
+				// Jobs already queued are not started once shutting down
+				if stopped(stop) {
+					summary.skip(job[0], job[1])
+					continue
+				}
+
 				log.Printf("starting worker %v with blocks %v-%v", i, job[0], job[1])
 				// Query the external resource for data
-				mergedAccounts, migratedAccounts := processBatchOfBlocks(ctx, db, job)
+				mergedAccounts, migratedAccounts, newBlockTimes, failedHeights := processBatchOfBlocks(ctx, source, times, filter, job)
 
 				// Process the data and insert into MySQL database
-				if err := insertIntoDB(ctx, db, migratedAccounts, mergedAccounts); err != nil {
+				err := db.InsertEvents(ctx, dblib.EventBatch{
+					Claims:     migratedAccounts,
+					Merged:     mergedAccounts,
+					BlockTimes: newBlockTimes,
+					Errors:     failedHeights,
+					Progress:   &dblib.Progress{FromHeight: job[0], ToHeight: job[1]},
+				})
+				if err != nil {
 					log.Printf("error inserting into database: %v", err)
+					summary.fail(job[0], job[1])
 					continue
 				}
+				summary.complete()
 			}
 		}(i)
 	}
 
 	// Generate jobs for each batch and send them to the jobs channel
-	for i := fromBlock; i < toBlock; i += BatchSize {
-		job := []int{i, i + BatchSize - 1}
-		if job[1] > toBlock {
-			job[1] = toBlock
-		}
+	for _, r := range pending {
+		for i := r[0]; i <= r[1]; i += batchSize {
+			job := []int{i, i + batchSize - 1}
+			if job[1] > r[1] {
+				job[1] = r[1]
+			}
 
-		jobs <- job
+			select {
+			case jobs <- job:
+			case <-stop:
+				summary.skip(job[0], job[1])
+			}
+		}
 	}
 
 	close(jobs)
 	wg.Wait()
 
+	summary.report()
+	if reporter, ok := source.(query.StatsReporter); ok {
+		reporter.ReportStats()
+	}
+
 	return nil
 }
 
-func processBatchOfBlocks(ctx context.Context, db *sql.DB, job []int) ([]dblib.MergedEvent, []dblib.ClaimEvent) {
-	mergedEvents, migratedEvents := []dblib.MergedEvent{}, []dblib.ClaimEvent{}
-	for height := job[0]; height <= job[1]; height++ {
-		blockResult, err := query.GetBlockResult(strconv.Itoa(height), 0)
-		if err != nil {
-			// This should be on Error database
-			error := dblib.Error{
-				Height: height,
-			}
-			if err := insertErrIntoDB(ctx, db, error); err != nil {
-				log.Printf("error inserting error value on DB at height %v: %v", height, err)
-			}
-			log.Printf("error querying external resource at height %v: %v", height, err)
+// pendingRanges returns the sub ranges of [fromBlock, toBlock] that are not
+// covered by the completed ranges. Completed ranges must be sorted by FromHeight.
+func pendingRanges(completed []dblib.Progress, fromBlock, toBlock int) [][]int {
+	pending := [][]int{}
+	next := fromBlock
+	for _, c := range completed {
+		if c.ToHeight < next {
 			continue
 		}
-		merged, migrated := filterAndDecodeEvents(blockResult.Result.TxsResults, height)
-		mergedEvents = append(mergedEvents, merged...)
-		migratedEvents = append(migratedEvents, migrated...)
-	}
-	log.Printf("finished job for blocks: %v - %v", job[0], job[1])
-	return mergedEvents, migratedEvents
-}
-
-func filterAndDecodeEvents(txs []query.ResponseDeliverTx, height int) ([]dblib.MergedEvent, []dblib.ClaimEvent) {
-	mergedEvents, migratedEvents := []dblib.MergedEvent{}, []dblib.ClaimEvent{}
-	//  Iterate over all txs in the block
-	for i := range txs {
-		// Iterate over all events in tx
-		for index := range txs[i].Events {
-			switch t := txs[i].Events[index].Type; t {
-			case "merge_claims_records":
-				v := txs[i].Events[index]
-				// Decode the attributes
-				err := v.DecodeAttributes()
-				if err != nil {
-					log.Printf("error decoding resource at height %v: %v", height, err)
-					// we should add this records to error table
-					// return nil, nil
-					continue
-				}
-				mergeRecord := dblib.MergedEvent{
-					Height:            height,
-					Recipient:         v.Attributes[0].Value,
-					ClaimedCoins:      v.Attributes[1].Value,
-					FundCommunityPool: v.Attributes[2].Value,
-				}
-				mergedEvents = append(mergedEvents, mergeRecord)
-				break
-			case "claim":
-				v := txs[i].Events[index]
-				// Decode the attributes
-				err := v.DecodeAttributes()
-				if err != nil {
-					log.Printf("error decoding resource at height %v: %v", height, err)
-					// we should add this records to error table
-					// return nil, nil
-					continue
-				}
-				migratedAccount := dblib.ClaimEvent{
-					Height: height,
-					Sender: v.Attributes[0].Value,
-					Amount: v.Attributes[1].Value,
-					Action: v.Attributes[2].Value,
-				}
-
-				// Decission was made to collect all claim data within decay block range
-				// instead of only merged / migrated accounts
-				// for context https://evmos.slack.com/archives/C022BMJSPQV/p1676632098959959
-				migratedEvents = append(migratedEvents, migratedAccount)
-			}
+		if c.FromHeight > toBlock {
+			break
 		}
+		if c.FromHeight > next {
+			pending = append(pending, []int{next, c.FromHeight - 1})
+		}
+		next = c.ToHeight + 1
 	}
-	return mergedEvents, migratedEvents
-}
-
-func insertErrIntoDB(ctx context.Context, db *sql.DB, error dblib.Error) error {
-	//Create a transaction on the database
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("error starting transaction: %v", err)
-	}
-	defer tx.Rollback()
-
-	// Insert data into merge_table Table
-	stmt1, err := dblib.PrepareInsertErrorQuery(ctx, tx)
-	if err != nil {
-		return fmt.Errorf("error preparing statement for ErrorTable: %v", err)
-	}
-	defer stmt1.Close()
-
-	err = dblib.ExecContextError(ctx, stmt1, error)
-	if err != nil {
-		return fmt.Errorf("error inserting data into Table1: %v", err)
-	}
-
-	// Commit the transaction
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("error committing transaction: %v", err)
+	if next <= toBlock {
+		pending = append(pending, []int{next, toBlock})
 	}
-
-	return nil
+	return pending
 }
 
-func insertIntoDB(ctx context.Context, db *sql.DB, migratedAccounts []dblib.ClaimEvent, mergedAccount []dblib.MergedEvent) error {
-	//Create a transaction on the database
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("error starting transaction: %v", err)
-	}
-	defer tx.Rollback()
-
-	// Insert data into merge_table Table
-	stmt1, err := dblib.PrepareInsertMergeEventQuery(ctx, tx)
-	if err != nil {
-		return fmt.Errorf("error preparing statement for Table1: %v", err)
-	}
-	defer stmt1.Close()
-
-	// Insert data into migrated_account table
-	stmt2, err := dblib.PrepareInsertClaimEventQuery(ctx, tx)
-	if err != nil {
-		return fmt.Errorf("error preparing statement for Table2: %v", err)
-	}
-	defer stmt2.Close()
-
-	for _, d := range mergedAccount {
-		err := dblib.ExecContextMergedEvent(ctx, stmt1, d)
+// processBatchOfBlocks queries every block in the job and returns its events stamped with the block time,
+// the block times to cache and the heights and events that could not be processed
+func processBatchOfBlocks(ctx context.Context, source query.BlockSource, times blockTimes, filter *eventFilter, job []int) ([]dblib.MergedEvent, []dblib.ClaimEvent, []dblib.BlockTime, []dblib.Error) {
+	mergedEvents, migratedEvents, newBlockTimes, failedHeights := []dblib.MergedEvent{}, []dblib.ClaimEvent{}, []dblib.BlockTime{}, []dblib.Error{}
+	for height := job[0]; height <= job[1]; height++ {
+		blockResult, err := source.GetBlockResult(ctx, height)
+		if ctx.Err() != nil {
+			// the batch is incomplete, it is not stored and will be processed on the next run
+			log.Printf("stopped job for blocks %v - %v at height %v: %v", job[0], job[1], height, ctx.Err())
+			break
+		}
 		if err != nil {
-			return fmt.Errorf("error inserting data into Table1: %v", err)
+			// This is stored on the Error table with the rest of the batch
+			failedHeights = append(failedHeights, dblib.Error{
+				Height: height,
+			})
+			log.Printf("error querying external resource at height %v: %v", height, err)
+			continue
+		}
+		merged, migrated, eventErrors := filter.filterAndDecodeEvents(blockResult.Result.TxsResults, height)
+		blockTime, err := times.stampEvents(ctx, height, merged, migrated)
+		if ctx.Err() != nil {
+			log.Printf("stopped job for blocks %v - %v at height %v: %v", job[0], job[1], height, ctx.Err())
+			break
 		}
-	}
-
-	for _, d := range migratedAccounts {
-		err := dblib.ExecContextClaimEvent(ctx, stmt2, d)
 		if err != nil {
-			return fmt.Errorf("error inserting data into Table1: %v", err)
+			// events are not stored without their time, the whole height is retried
+			failedHeights = append(failedHeights, dblib.Error{
+				Height:  height,
+				Message: err.Error(),
+			})
+			log.Printf("error querying external resource at height %v: %v", height, err)
+			continue
 		}
+		mergedEvents = append(mergedEvents, merged...)
+		migratedEvents = append(migratedEvents, migrated...)
+		newBlockTimes = append(newBlockTimes, blockTime...)
+		failedHeights = append(failedHeights, eventErrors...)
 	}
-
-	// Commit the transaction
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("error committing transaction: %v", err)
-	}
-
-	return nil
+	log.Printf("finished job for blocks: %v - %v", job[0], job[1])
+	return mergedEvents, migratedEvents, newBlockTimes, failedHeights
 }
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/query"
+)
+
+// blocksDir holds the block results and headers of heights 20 to 22, height 23 is missing
+const blocksDir = "testdata/blocks"
+
+func newTestFilter(t *testing.T) *eventFilter {
+	t.Helper()
+	filter, err := newEventFilter(config.DefaultEventRules(), "aevmos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filter
+}
+
+func TestProcessBatchOfBlocks(t *testing.T) {
+	source := query.NewFileSource(blocksDir)
+	db := newFakeStore()
+	// The time of height 20 is cached so it is not returned again
+	day20 := time.Date(2022, 5, 20, 0, 0, 0, 0, time.UTC)
+	day21 := time.Date(2022, 5, 21, 0, 0, 0, 0, time.UTC)
+	db.blockTimes[20] = day20
+
+	merged, claims, times, errs := processBatchOfBlocks(context.Background(), source, blockTimes{store: db, source: source}, newTestFilter(t), []int{20, 23})
+
+	wantMerged := []dblib.MergedEvent{
+		{Recipient: "evmos1r", ClaimedCoins: "10", ClaimedDenom: "aevmos", FundCommunityPool: "2", FundCommunityPoolDenom: "aevmos", Height: 20, TxIndex: 1, EventIndex: 1, BlockTime: day20},
+	}
+	if len(merged) != len(wantMerged) || merged[0] != wantMerged[0] {
+		t.Errorf("got merged events %+v, want %+v", merged, wantMerged)
+	}
+
+	// Only the claims denom of a multi-denom amount is stored
+	wantClaims := []dblib.ClaimEvent{
+		{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "5", Denom: "aevmos", Height: 20, TxIndex: 0, EventIndex: 1, BlockTime: day20},
+		{Sender: "evmos1a", Action: "ACTION_DELEGATE", Amount: "5", Denom: "aevmos", Height: 21, TxIndex: 0, EventIndex: 0, BlockTime: day21},
+	}
+	if len(claims) != len(wantClaims) {
+		t.Fatalf("got claims %+v, want %+v", claims, wantClaims)
+	}
+	for i := range wantClaims {
+		if claims[i] != wantClaims[i] {
+			t.Errorf("claim %v: got %+v, want %+v", i, claims[i], wantClaims[i])
+		}
+	}
+
+	if len(times) != 1 || times[0].Height != 21 || !times[0].Time.Equal(day21) {
+		t.Errorf("got block times %+v, want the one of height 21", times)
+	}
+
+	// The events that can not be decoded and the missing height are recorded as errors
+	wantErrs := []dblib.Error{
+		{Height: 21, EventType: "claim", TxIndex: "0", EventIndex: "1", Message: `attribute "amount": no aevmos on coins "5uosmo"`},
+		{Height: 21, EventType: "claim", TxIndex: "0", EventIndex: "2", Message: `attribute "amount": invalid coin "5 aevmos!"`},
+		{Height: 23},
+	}
+	if len(errs) != len(wantErrs) {
+		t.Fatalf("got errors %+v, want %+v", errs, wantErrs)
+	}
+	for i := range wantErrs {
+		if errs[i] != wantErrs[i] {
+			t.Errorf("error %v: got %+v, want %+v", i, errs[i], wantErrs[i])
+		}
+	}
+}
+
+func TestHandleWorkers(t *testing.T) {
+	db := newFakeStore()
+	db.progress = []dblib.Progress{{FromHeight: 18, ToHeight: 19}}
+
+	err := handleWorkers(context.Background(), make(chan struct{}), db, query.NewFileSource(blocksDir), newTestFilter(t), 18, 23, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed, _ := db.CompletedRanges(context.Background())
+	want := []dblib.Progress{{FromHeight: 18, ToHeight: 19}, {FromHeight: 20, ToHeight: 21}, {FromHeight: 22, ToHeight: 23}}
+	if len(completed) != len(want) {
+		t.Fatalf("got completed ranges %+v, want %+v", completed, want)
+	}
+	for i := range want {
+		if completed[i] != want[i] {
+			t.Errorf("range %v: got %+v, want %+v", i, completed[i], want[i])
+		}
+	}
+	if len(db.claims) != 2 || len(db.merged) != 1 || len(db.errors) != 3 || len(db.blockTimes) != 2 {
+		t.Errorf("got %v claims, %v merged events, %v errors and %v block times, want 2, 1, 3 and 2",
+			len(db.claims), len(db.merged), len(db.errors), len(db.blockTimes))
+	}
+}
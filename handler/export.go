@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/export"
+)
+
+// Export writes the rows of a table or query on the format to out, stdout when empty
+func Export(cfg config.Config, e dblib.Export, format, out string) {
+	// The logs go to stderr when the rows are written to stdout
+	var w io.Writer = os.Stdout
+	if out != "" {
+		logFile := setupLogFile(cfg.LogPath)
+		defer logFile.Close()
+
+		f, err := os.Create(out)
+		if err != nil {
+			log.Fatalf("error creating %v: %v", out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	db := openStore(cfg)
+	defer db.Close()
+
+	count, err := exportRows(context.Background(), db, e, format, w)
+	if err != nil {
+		if out != "" {
+			os.Remove(out)
+		}
+		log.Fatalf("error exporting: %v", err)
+	}
+	if out != "" {
+		log.Printf("exported %v rows to %v", count, out)
+	}
+}
+
+// exportStore reads the rows of the tables or queries exported
+type exportStore interface {
+	Export(ctx context.Context, e dblib.Export, fn func(rows *sql.Rows) error) error
+}
+
+// exportRows writes the rows of the export returning how many were written
+func exportRows(ctx context.Context, db exportStore, e dblib.Export, format string, w io.Writer) (int, error) {
+	count := 0
+	err := db.Export(ctx, e, func(rows *sql.Rows) error {
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		columns := make([]export.Column, len(types))
+		for i, t := range types {
+			columns[i] = export.Column{Name: t.Name(), Kind: export.KindOf(t.DatabaseTypeName())}
+		}
+		ew, err := export.NewWriter(format, w, columns)
+		if err != nil {
+			return err
+		}
+
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(ptrs...); err != nil {
+				return err
+			}
+			if err := ew.Write(values); err != nil {
+				return fmt.Errorf("row %v: %v", count+1, err)
+			}
+			count++
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return ew.Close()
+	})
+	return count, err
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/query"
+)
+
+// ImportGenesis stores the claims records and params of the genesis on the
+// claims_record and claims_params tables, replacing any previous import
+func ImportGenesis(cfg config.Config) {
+	// Log to a file to have persistent logs and open the migrated database
+	db, closeAll := setup(cfg, cfg.LogPath)
+	defer closeAll()
+
+	// Set up context cancelled on shutdown signals
+	ctx, _, cancel := withShutdown()
+	defer cancel()
+
+	file, err := os.Open(cfg.GenesisPath)
+	if err != nil {
+		log.Fatalf("error reading the genesis: %v", err)
+	}
+	defer file.Close()
+
+	imported, skipped, err := importClaims(ctx, db, file)
+	if err != nil {
+		log.Fatalf("error importing genesis: %v", err)
+	}
+	logSummary("imported %v claims records, skipped %v invalid ones", imported, skipped)
+}
+
+// importClaims streams the claims of the genesis read from r, replacing the
+// stored claims records and params within a single transaction
+func importClaims(ctx context.Context, db claimsStore, r io.Reader) (int, int, error) {
+	foundParams := false
+	imported, skipped := 0, 0
+
+	err := db.ImportClaims(ctx, func(w dblib.ClaimsWriter) error {
+		decoder := query.NewClaimsDecoder(r)
+		decoder.OnParams = func(params query.ClaimsParams) error {
+			foundParams = true
+			return w.SetParams(dblib.ClaimsParams{
+				EnableClaims:       params.EnableClaims,
+				AirdropStartTime:   params.AirdropStartTime,
+				DurationUntilDecay: params.DurationUntilDecay,
+				DurationOfDecay:    params.DurationOfDecay,
+				ClaimsDenom:        params.ClaimsDenom,
+			})
+		}
+		decoder.OnRecord = func(record query.ClaimsRecord) error {
+			if _, ok := new(big.Int).SetString(record.InialClaimableAmount, 10); !ok || record.Address == "" {
+				log.Printf("skipping invalid claims record %q with initial claimable amount %q", record.Address, record.InialClaimableAmount)
+				skipped++
+				return nil
+			}
+			actions, err := json.Marshal(record.ActionsCompleted)
+			if err != nil {
+				return err
+			}
+			err = w.AddRecord(dblib.ClaimsRecord{
+				Address:                record.Address,
+				ActionsCompleted:       string(actions),
+				InitialClaimableAmount: record.InialClaimableAmount,
+			})
+			if err != nil {
+				return err
+			}
+			imported++
+			if imported%100000 == 0 {
+				log.Printf("imported %v claims records...", imported)
+			}
+			return nil
+		}
+
+		if err := decoder.Decode(); err != nil {
+			return fmt.Errorf("error decoding genesis: %v", err)
+		}
+		if !foundParams {
+			return fmt.Errorf("genesis has no claims params")
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return imported, skipped, nil
+}
+
+// getClaimsParams returns the claims params stored by import-genesis
+func getClaimsParams(ctx context.Context, db claimsStore) (query.ClaimsParams, error) {
+	stored, err := db.ClaimsParams(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return query.ClaimsParams{}, fmt.Errorf("no claims params found, run import-genesis first")
+	}
+	if err != nil {
+		return query.ClaimsParams{}, err
+	}
+	return query.ClaimsParams{
+		EnableClaims:       stored.EnableClaims,
+		AirdropStartTime:   stored.AirdropStartTime,
+		DurationUntilDecay: stored.DurationUntilDecay,
+		DurationOfDecay:    stored.DurationOfDecay,
+		ClaimsDenom:        stored.ClaimsDenom,
+	}, nil
+}
@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/decay"
+)
+
+// importColumns lists the columns of each table that can be imported, the required ones first
+var importColumns = map[string]struct {
+	required []string
+	optional []string
+}{
+	"claim_event": {
+		required: []string{"sender", "height", "amount", "claim_action"},
+		optional: []string{"id", "tx_index", "event_index", "denom", "block_time"},
+	},
+	"merged_event": {
+		required: []string{"recipient", "height", "claimed_coins", "fund_community_pool_coins"},
+		optional: []string{"id", "sender", "tx_index", "event_index", "claimed_denom", "fund_community_pool_denom", "block_time"},
+	},
+	"block_time": {
+		required: []string{"height", "time"},
+	},
+}
+
+// ImportTables are the tables import can load
+var ImportTables = []string{"claim_event", "merged_event", "block_time"}
+
+// claimActions are the valid claim_action values
+var claimActions = []string{decay.ActionVote, decay.ActionDelegate, decay.ActionEVM, decay.ActionIBCTransfer}
+
+// ImportCSV loads the rows of a CSV file, as exported by export or the sqlite shell, into the table.
+// Invalid rows are logged and skipped, and rows already on the file or the database are not stored
+// twice, as matched by ImportEvents.
+func ImportCSV(cfg config.Config, table, path string) {
+	// Log to a file to have persistent logs and open the migrated database
+	db, closeAll := setup(cfg, cfg.LogPath)
+	defer closeAll()
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("error opening %v: %v", path, err)
+	}
+	defer file.Close()
+
+	batch, read, skipped, err := readImport(file, table, cfg.ClaimsDenom)
+	if err != nil {
+		log.Fatalf("error reading %v: %v", path, err)
+	}
+
+	result, err := db.ImportEvents(context.Background(), batch)
+	if err != nil {
+		log.Fatalf("error importing %v: %v", path, err)
+	}
+	stored := result.Claims + result.Merged + result.BlockTimes
+	logSummary("read %v rows, skipped %v invalid ones, stored %v, %v were already stored",
+		read, skipped, stored, read-skipped-stored)
+}
+
+// importStore stores the imported events
+type importStore interface {
+	ImportEvents(ctx context.Context, batch dblib.EventBatch) (dblib.ImportResult, error)
+}
+
+// readImport reads the rows of the CSV from r into a batch of the table, returning the
+// amount of rows read and of invalid ones skipped. Coins are stored as their amount of the
+// claims denom. Repeated rows are kept, ImportEvents stores them once.
+func readImport(r io.Reader, table, claimsDenom string) (dblib.EventBatch, int, int, error) {
+	batch := dblib.EventBatch{}
+	columns, ok := importColumns[table]
+	if !ok {
+		return batch, 0, 0, fmt.Errorf("can not import table %q, expected one of %v", table, strings.Join(ImportTables, ", "))
+	}
+
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return batch, 0, 0, fmt.Errorf("error reading header: %v", err)
+	}
+	index := make(map[string]int)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if !contains(columns.required, name) && !contains(columns.optional, name) {
+			return batch, 0, 0, fmt.Errorf("unknown column %q of table %v", name, table)
+		}
+		index[name] = i
+	}
+	for _, name := range columns.required {
+		if _, ok := index[name]; !ok {
+			return batch, 0, 0, fmt.Errorf("missing column %q of table %v", name, table)
+		}
+	}
+
+	amounts := &eventFilter{denom: claimsDenom}
+	read, skipped := 0, 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return batch, read, skipped, err
+		}
+		read++
+		line, _ := reader.FieldPos(0)
+		row := importRow{record: record, index: index}
+
+		switch table {
+		case "claim_event":
+			var e dblib.ClaimEvent
+			if e, err = row.claimEvent(amounts); err == nil {
+				batch.Claims = append(batch.Claims, e)
+			}
+		case "merged_event":
+			var e dblib.MergedEvent
+			if e, err = row.mergedEvent(amounts); err == nil {
+				batch.Merged = append(batch.Merged, e)
+			}
+		case "block_time":
+			var t dblib.BlockTime
+			if t, err = row.blockTime(); err == nil {
+				batch.BlockTimes = append(batch.BlockTimes, t)
+			}
+		}
+		if err != nil {
+			log.Printf("skipping invalid row on line %v: %v", line, err)
+			skipped++
+		}
+	}
+	return batch, read, skipped, nil
+}
+
+// importRow is a CSV record along with the index of each column
+type importRow struct {
+	record []string
+	index  map[string]int
+}
+
+// get returns the trimmed value of the column, empty if the file does not have it
+func (r importRow) get(column string) string {
+	i, ok := r.index[column]
+	if !ok || i >= len(r.record) {
+		return ""
+	}
+	return strings.TrimSpace(r.record[i])
+}
+
+func (r importRow) height() (int, error) {
+	height, err := strconv.Atoi(r.get("height"))
+	if err != nil || height <= 0 {
+		return 0, fmt.Errorf("invalid height %q", r.get("height"))
+	}
+	return height, nil
+}
+
+// eventIndex returns the value of an index column, UnknownIndex when empty
+func (r importRow) eventIndex(column string) (int, error) {
+	value := r.get(column)
+	if value == "" {
+		return dblib.UnknownIndex, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid %v %q", column, value)
+	}
+	return i, nil
+}
+
+func (r importRow) indexes() (int, int, error) {
+	txIndex, err := r.eventIndex("tx_index")
+	if err != nil {
+		return 0, 0, err
+	}
+	eventIndex, err := r.eventIndex("event_index")
+	if err != nil {
+		return 0, 0, err
+	}
+	if (txIndex == dblib.UnknownIndex) != (eventIndex == dblib.UnknownIndex) {
+		return 0, 0, fmt.Errorf("tx_index and event_index must be both set or both empty")
+	}
+	return txIndex, eventIndex, nil
+}
+
+// time returns the value of a time column, zero when empty
+func (r importRow) time(column string) (time.Time, error) {
+	value := r.get(column)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid %v %q", column, value)
+}
+
+// amount returns the amount of the claims denom of a coins column, either raw coins
+// like `100aevmos` or an integer of the denom column, which must be the claims denom
+func (r importRow) amount(column, denomColumn string, amounts *eventFilter) (string, error) {
+	value := r.get(column)
+	if _, ok := new(big.Int).SetString(value, 10); ok {
+		if denom := r.get(denomColumn); denom != "" && denom != amounts.denom {
+			return "", fmt.Errorf("%v has denom %q instead of %v", column, denom, amounts.denom)
+		}
+		return value, nil
+	}
+	amount, err := amounts.amountOf(value)
+	if err != nil {
+		return "", fmt.Errorf("%v: %v", column, err)
+	}
+	return amount, nil
+}
+
+func (r importRow) claimEvent(amounts *eventFilter) (dblib.ClaimEvent, error) {
+	e := dblib.ClaimEvent{Sender: r.get("sender"), Action: r.get("claim_action"), Denom: amounts.denom}
+	if e.Sender == "" {
+		return e, fmt.Errorf("empty sender")
+	}
+	if !contains(claimActions, e.Action) {
+		return e, fmt.Errorf("unknown claim_action %q", e.Action)
+	}
+	var err error
+	if e.Height, err = r.height(); err != nil {
+		return e, err
+	}
+	if e.TxIndex, e.EventIndex, err = r.indexes(); err != nil {
+		return e, err
+	}
+	if e.Amount, err = r.amount("amount", "denom", amounts); err != nil {
+		return e, err
+	}
+	if e.BlockTime, err = r.time("block_time"); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+func (r importRow) mergedEvent(amounts *eventFilter) (dblib.MergedEvent, error) {
+	e := dblib.MergedEvent{
+		Recipient:              r.get("recipient"),
+		Sender:                 r.get("sender"),
+		ClaimedDenom:           amounts.denom,
+		FundCommunityPoolDenom: amounts.denom,
+	}
+	if e.Recipient == "" {
+		return e, fmt.Errorf("empty recipient")
+	}
+	var err error
+	if e.Height, err = r.height(); err != nil {
+		return e, err
+	}
+	if e.TxIndex, e.EventIndex, err = r.indexes(); err != nil {
+		return e, err
+	}
+	if e.ClaimedCoins, err = r.amount("claimed_coins", "claimed_denom", amounts); err != nil {
+		return e, err
+	}
+	if e.FundCommunityPool, err = r.amount("fund_community_pool_coins", "fund_community_pool_denom", amounts); err != nil {
+		return e, err
+	}
+	if e.BlockTime, err = r.time("block_time"); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+func (r importRow) blockTime() (dblib.BlockTime, error) {
+	var t dblib.BlockTime
+	var err error
+	if t.Height, err = r.height(); err != nil {
+		return t, err
+	}
+	if t.Time, err = r.time("time"); err != nil {
+		return t, err
+	}
+	if t.Time.IsZero() {
+		return t, fmt.Errorf("empty time")
+	}
+	return t, nil
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	dblib "github.com/facs95/decay-data/db"
+)
+
+func TestReadImportClaims(t *testing.T) {
+	csv := `sender,height,tx_index,event_index,amount,claim_action,block_time
+evmos1a,10,0,1,100aevmos,ACTION_VOTE,2022-04-27T12:00:00Z
+evmos1a,10,0,1,100aevmos,ACTION_VOTE,2022-04-27T12:00:00Z
+evmos1b,11,,,250,ACTION_EVM,
+evmos1c,12,,,5,ACTION_FLY,
+evmos1d,0,,,5,ACTION_VOTE,
+evmos1e,13,1,,5,ACTION_VOTE,
+evmos1f,14,,,5uosmo,ACTION_VOTE,
+evmos1g,15,,,5,ACTION_VOTE,yesterday
+,16,,,5,ACTION_VOTE,
+`
+	batch, read, skipped, err := readImport(strings.NewReader(csv), "claim_event", "aevmos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != 9 || skipped != 6 {
+		t.Errorf("got %v rows read and %v skipped, want 9 and 6", read, skipped)
+	}
+	// Repeated rows are kept, ImportEvents stores the ones with indexes once
+	want := []dblib.ClaimEvent{
+		{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "100", Denom: "aevmos", Height: 10, TxIndex: 0, EventIndex: 1, BlockTime: time.Date(2022, 4, 27, 12, 0, 0, 0, time.UTC)},
+		{Sender: "evmos1a", Action: "ACTION_VOTE", Amount: "100", Denom: "aevmos", Height: 10, TxIndex: 0, EventIndex: 1, BlockTime: time.Date(2022, 4, 27, 12, 0, 0, 0, time.UTC)},
+		{Sender: "evmos1b", Action: "ACTION_EVM", Amount: "250", Denom: "aevmos", Height: 11, TxIndex: dblib.UnknownIndex, EventIndex: dblib.UnknownIndex},
+	}
+	if len(batch.Claims) != len(want) {
+		t.Fatalf("got claims %+v, want %+v", batch.Claims, want)
+	}
+	for i := range want {
+		if batch.Claims[i] != want[i] {
+			t.Errorf("claim %v: got %+v, want %+v", i, batch.Claims[i], want[i])
+		}
+	}
+}
+
+func TestReadImportMergedAndBlockTimes(t *testing.T) {
+	csv := `recipient,height,claimed_coins,claimed_denom,fund_community_pool_coins,fund_community_pool_denom
+evmos1a,10,300,aevmos,5,aevmos
+evmos1b,11,300,uosmo,5,aevmos
+`
+	batch, read, skipped, err := readImport(strings.NewReader(csv), "merged_event", "aevmos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != 2 || skipped != 1 || len(batch.Merged) != 1 || batch.Merged[0].ClaimedCoins != "300" || batch.Merged[0].FundCommunityPool != "5" {
+		t.Errorf("got %+v, %v read and %v skipped", batch.Merged, read, skipped)
+	}
+
+	csv = "height,time\n10,2022-04-27 12:00:00\n11,\n"
+	batch, read, skipped, err = readImport(strings.NewReader(csv), "block_time", "aevmos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != 2 || skipped != 1 || len(batch.BlockTimes) != 1 || !batch.BlockTimes[0].Time.Equal(time.Date(2022, 4, 27, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %+v, %v read and %v skipped", batch.BlockTimes, read, skipped)
+	}
+}
+
+func TestReadImportHeader(t *testing.T) {
+	tests := []struct {
+		name, table, csv string
+	}{
+		{"unknown table", "decay_amount", "sender\n"},
+		{"unknown column", "block_time", "height,time,extra\n"},
+		{"missing column", "claim_event", "sender,height,amount\n"},
+		{"empty file", "block_time", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, _, err := readImport(strings.NewReader(tc.csv), tc.table, "aevmos"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
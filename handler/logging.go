@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/facs95/decay-data/config"
+)
+
+// setupLogFile sends the logs to both stdout and the file at path so they are persisted
+func setupLogFile(path string) *os.File {
+	logFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		log.Fatalf("error opening file: %v", err)
+	}
+
+	wrt := io.MultiWriter(os.Stdout, logFile)
+	log.SetOutput(wrt)
+	return logFile
+}
+
+// setup sends the logs to the file at logPath and opens the migrated database,
+// the returned func closes both
+func setup(cfg config.Config, logPath string) (Store, func()) {
+	logFile := setupLogFile(logPath)
+	db := openStore(cfg)
+	return db, func() {
+		db.Close()
+		logFile.Close()
+	}
+}
+
+// logSummary logs the outcome of a command, its last line on the log
+func logSummary(format string, args ...interface{}) {
+	log.Printf("summary: "+format, args...)
+}
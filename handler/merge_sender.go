@@ -2,98 +2,75 @@ package handler
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"io"
+	"fmt"
 	"log"
-	"os"
-	"strconv"
 	"sync"
 
+	"github.com/facs95/decay-data/coin"
+	"github.com/facs95/decay-data/config"
 	dblib "github.com/facs95/decay-data/db"
 	"github.com/facs95/decay-data/query"
-	_ "github.com/mattn/go-sqlite3"
 )
 
-func CollectMergeSenders() {
-	// Create a log file to have persistent logs
-	logFile, err := os.OpenFile("./output.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("error opening file: %v", err)
-	}
-	defer logFile.Close()
+func CollectMergeSenders(cfg config.Config, source query.BlockSource) {
+	// Log to a file to have persistent logs and open the migrated database
+	db, closeAll := setup(cfg, cfg.LogPath)
+	defer closeAll()
 
-	wrt := io.MultiWriter(os.Stdout, logFile)
-	log.SetOutput(wrt)
-
-	var accountsToProcess []dblib.MergedEvent
-	// Set up database connection
-	db, err := sql.Open("sqlite3", "./accounts.db")
-	if err != nil {
-		log.Fatalf("error opening database connection: %v", err)
-	}
-	defer db.Close()
+	// Set up context cancelled on shutdown signals
+	ctx, stop, cancel := withShutdown()
+	defer cancel()
 
-	// For each account get its info
-	rows, err := db.Query("select id, recipient, height, claimed_coins, fund_community_pool_coins from merged_event order by id")
+	// Senders resolved on previous runs are skipped
+	accountsToProcess, err := db.MergedEventsWithoutSender(ctx)
 	if err != nil {
 		log.Fatalf("Error reading addresses %v", err)
 	}
-
-	for rows.Next() {
-		var address string
-		var height int
-		var id int
-		var claimedCoins string
-		var fundCommunityPoolCoins string
-		err := rows.Scan(&id, &address, &height, &claimedCoins, &fundCommunityPoolCoins)
-		if err != nil {
-			log.Fatalf("Error getting row: %v", err)
-		}
-		accountsToProcess = append(accountsToProcess, dblib.MergedEvent{Recipient: address, Height: height, ID: id, ClaimedCoins: claimedCoins, FundCommunityPool: fundCommunityPoolCoins})
-	}
-
 	log.Println("Finished getting all the addresses")
-	rows.Close()
 
-	if err := orchestrator(db, accountsToProcess); err != nil {
+	if err := orchestrator(ctx, stop, db, source, accountsToProcess, cfg.BatchSize, cfg.MaxWorkers); err != nil {
 		log.Printf("Error executing the orchestrator: %v", err)
 	}
 
-	db.Close()
+	if reporter, ok := source.(query.StatsReporter); ok {
+		reporter.ReportStats()
+	}
+
 	log.Println("Job finished")
 }
 
-// Add a column to the same table with the sender
-
-// Do the same go ruotine process and query each block
-
-// Once I have the block the only thing I need is to look for the `recv_packet` event
-// get the first attribute
-// And from here get the sender
-
-func orchestrator(db *sql.DB, items []dblib.MergedEvent) error {
-	// Set up context with cancellation
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+func orchestrator(ctx context.Context, stop <-chan struct{}, db mergeSenderStore, source query.BlockSource, items []dblib.MergedEvent, batchSize int, maxWorkers int) error {
+	summary := newRunSummary("events")
 
 	// Create a channel to hold jobs to be executed by workers
-	jobs := make(chan []dblib.MergedEvent, MaxWorkers)
+	jobs := make(chan []dblib.MergedEvent, maxWorkers)
 	// Create a WaitGroup to wait for all workers to complete
 	wg := sync.WaitGroup{}
 
 	// Launch worker goroutines
-	for i := 0; i < MaxWorkers; i++ {
+	for i := 0; i < maxWorkers; i++ {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
 			for job := range jobs {
+				// Jobs already queued are not started once shutting down
+				if stopped(stop) {
+					summary.skip(job[0].ID, job[len(job)-1].ID)
+					continue
+				}
+
 				log.Printf("starting worker %v with events %v-%v", i, job[0].ID, job[len(job)-1].ID)
 				// Query the external resource for data
-				queueOfEventsToUpdate := processBatchOfEvents(job)
+				queueOfEventsToUpdate, eventErrors := processBatchOfEvents(ctx, source, job)
 
 				// Process the data and insert into MySQL database
-				updateQueueOfEventsToUpdate(db, ctx, queueOfEventsToUpdate)
+				if err := db.UpdateMergeSenders(ctx, queueOfEventsToUpdate, eventErrors); err != nil {
+					log.Printf("error updating merged events: %v", err)
+					summary.fail(job[0].ID, job[len(job)-1].ID)
+					continue
+				}
+				summary.complete()
 				log.Printf("finished worker %v", i)
 			}
 		}(i)
@@ -102,52 +79,26 @@ func orchestrator(db *sql.DB, items []dblib.MergedEvent) error {
 	limit := len(items)
 	log.Printf("total events to process: %v", limit)
 	// Generate jobs for each batch and send them to the jobs channel
-	for i := 0; i < limit; i += BatchSize {
-		end := i + BatchSize
+	for i := 0; i < limit; i += batchSize {
+		end := i + batchSize
 
 		if end > limit {
 			end = limit
 		}
 
 		// produce a copy to avoid concurrent issues
-		jobs <- copySliceOfStructs(items[i:end])
+		select {
+		case jobs <- copySliceOfStructs(items[i:end]):
+		case <-stop:
+			summary.skip(items[i].ID, items[end-1].ID)
+		}
 	}
 
 	close(jobs)
 	wg.Wait()
-	return nil
-}
-
-func updateQueueOfEventsToUpdate(db *sql.DB, ctx context.Context, queueOfEventsToUpdate []dblib.MergedEvent) {
-	//Create a transaction on the database
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		log.Printf("error starting transaction: %v", err)
-		return
-	}
-	defer tx.Rollback()
 
-	stmt, err := dblib.PrepareUpdateSenderMergeEventQuery(ctx, tx)
-	if err != nil {
-		log.Printf("error preparing statement for update: %v", err)
-		return
-	}
-	defer stmt.Close()
-
-	//update events in database by ID
-	for _, event := range queueOfEventsToUpdate {
-		if err := dblib.ExecContextMergeEventUpdate(ctx, stmt, event); err != nil {
-			log.Printf("error updating merged event: %v", err)
-			continue
-		}
-	}
-
-	// Commit the transaction
-	err = tx.Commit()
-	if err != nil {
-		log.Printf("error committing transaction: %v", err)
-		return
-	}
+	summary.report()
+	return nil
 }
 
 // copy slice of structs
@@ -157,30 +108,38 @@ func copySliceOfStructs(s []dblib.MergedEvent) []dblib.MergedEvent {
 	return c
 }
 
-func processBatchOfEvents(events []dblib.MergedEvent) []dblib.MergedEvent {
-	queueOfEventsToUpdate := []dblib.MergedEvent{}
+func processBatchOfEvents(ctx context.Context, source query.BlockSource, events []dblib.MergedEvent) ([]dblib.MergedEvent, []dblib.Error) {
+	queueOfEventsToUpdate, eventErrors := []dblib.MergedEvent{}, []dblib.Error{}
 	for _, event := range events {
-		blockResult, err := query.GetBlockResult(strconv.Itoa(event.Height), 0)
+		blockResult, err := source.GetBlockResult(ctx, event.Height)
+		if ctx.Err() != nil {
+			log.Printf("stopped processing events at event %v: %v", event.ID, ctx.Err())
+			break
+		}
 		if err != nil {
 			log.Printf("error getting block result: %v", err)
 			continue
 		}
-		tx, found := findTxWithinBlockResultTxs(event, blockResult.Result.TxsResults)
+		tx, txIndex, found, errs := findTxWithinBlockResultTxs(event, blockResult.Result.TxsResults)
+		eventErrors = append(eventErrors, errs...)
 		if !found {
 			log.Printf("error finding tx within block result txs for event: %v", event.ID)
 			continue
 		}
-		sender, found := findSenderWithinEvents(tx)
+		sender, found, errs := findSenderWithinEvents(tx, event.Height, txIndex)
+		eventErrors = append(eventErrors, errs...)
 		if !found {
 			log.Printf("error finding sender for event: %v", event.ID)
 			continue
 		}
 		queueOfEventsToUpdate = append(queueOfEventsToUpdate, dblib.MergedEvent{ID: event.ID, Sender: sender})
 	}
-	return queueOfEventsToUpdate
+	return queueOfEventsToUpdate, eventErrors
 }
 
-func findTxWithinBlockResultTxs(event dblib.MergedEvent, txs []query.ResponseDeliverTx) (tx query.ResponseDeliverTx, found bool) {
+// findTxWithinBlockResultTxs returns the tx holding the merge_claims_records event
+// and an error for each merge event of the block that could not be read
+func findTxWithinBlockResultTxs(event dblib.MergedEvent, txs []query.ResponseDeliverTx) (tx query.ResponseDeliverTx, txIndex int, found bool, eventErrors []dblib.Error) {
 	//  Iterate over all txs in the block
 	for i := range txs {
 		// Iterate over all events in tx
@@ -191,24 +150,28 @@ func findTxWithinBlockResultTxs(event dblib.MergedEvent, txs []query.ResponseDel
 				// Decode the attributes
 				err := v.DecodeAttributes()
 				if err != nil {
-					log.Printf("error decoding resource at height %v", err)
-					// we should add this records to error table
-					// return nil, nil
+					log.Printf("error decoding resource at height %v: %v", event.Height, err)
+					eventErrors = append(eventErrors, newEventError(event.Height, i, index, v.Type, err))
+					continue
+				}
+				isTx, err := isTransaction(event, v)
+				if err != nil {
+					log.Printf("error reading merge event at height %v: %v", event.Height, err)
+					eventErrors = append(eventErrors, newEventError(event.Height, i, index, v.Type, err))
 					continue
 				}
-				isTx := isTransaction(event, v.Attributes)
 				if isTx {
-					return txs[i], true
+					return txs[i], i, true, eventErrors
 				}
 			}
 		}
 	}
-	return query.ResponseDeliverTx{}, false
+	return query.ResponseDeliverTx{}, 0, false, eventErrors
 }
 
 // findSenderWithinEvents find sender on recv_packet event
 // - Looks for recv_packet
-func findSenderWithinEvents(tx query.ResponseDeliverTx) (sender string, found bool) {
+func findSenderWithinEvents(tx query.ResponseDeliverTx, height int, txIndex int) (sender string, found bool, eventErrors []dblib.Error) {
 	// Iterate over all events in tx
 	for eventIndex := range tx.Events {
 		switch t := tx.Events[eventIndex].Type; t {
@@ -217,33 +180,52 @@ func findSenderWithinEvents(tx query.ResponseDeliverTx) (sender string, found bo
 			// Decode the attributes
 			err := v.DecodeAttributes()
 			if err != nil {
-				log.Printf("error decoding resource at height %v", err)
-				// we should add this records to error table
-				// return nil, nil
+				log.Printf("error decoding resource at height %v: %v", height, err)
+				eventErrors = append(eventErrors, newEventError(height, txIndex, eventIndex, v.Type, err))
+				continue
+			}
+
+			data, err := v.Attribute("packet_data")
+			if err != nil {
+				log.Printf("error reading packet data at height %v: %v", height, err)
+				eventErrors = append(eventErrors, newEventError(height, txIndex, eventIndex, v.Type, err))
 				continue
 			}
 
 			// unmarshal the packet data
 			packetData := &query.PacketData{}
-			err = json.Unmarshal([]byte(v.Attributes[0].Value), &packetData)
+			err = json.Unmarshal([]byte(data), &packetData)
 			if err != nil {
 				log.Printf("error unmarshalling packet data: %v", err)
+				eventErrors = append(eventErrors, newEventError(height, txIndex, eventIndex, v.Type, fmt.Errorf("error unmarshalling packet data: %v", err)))
 				continue
 			}
 
-			return packetData.Sender, true
+			return packetData.Sender, true, eventErrors
 
 		}
 	}
-	return "", false
+	return "", false, eventErrors
 }
 
 // find event within array of dblib.mergedEvents based on the Recipient and height
-func isTransaction(event dblib.MergedEvent, attributes []query.Attribute) bool {
-	if event.Recipient == attributes[0].Value &&
-		event.ClaimedCoins == attributes[1].Value &&
-		event.FundCommunityPool == attributes[2].Value {
-		return true
+func isTransaction(event dblib.MergedEvent, mergeEvent query.Event) (bool, error) {
+	values, err := mergeEvent.AttributeValues("recipient", "claimed_coins", "fund_community_pool_coins")
+	if err != nil {
+		return false, err
+	}
+	claimedCoins, err := coin.ParseCoins(values[1])
+	if err != nil {
+		return false, fmt.Errorf("attribute \"claimed_coins\": %v", err)
+	}
+	fundCommunityPoolCoins, err := coin.ParseCoins(values[2])
+	if err != nil {
+		return false, fmt.Errorf("attribute \"fund_community_pool_coins\": %v", err)
+	}
+	if event.Recipient == values[0] &&
+		event.ClaimedCoins == claimedCoins.AmountOf(event.ClaimedDenom).String() &&
+		event.FundCommunityPool == fundCommunityPoolCoins.AmountOf(event.FundCommunityPoolDenom).String() {
+		return true, nil
 	}
-	return false
+	return false, nil
 }
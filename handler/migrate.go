@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/facs95/decay-data/config"
+)
+
+// Migrate applies the pending schema migrations to the database
+func Migrate(cfg config.Config) {
+	// Log to a file to have persistent logs and open the migrated database
+	db, closeAll := setup(cfg, cfg.LogPath)
+	defer closeAll()
+
+	applied, err := db.AppliedMigrations()
+	if err != nil {
+		log.Fatalf("error reading schema version: %v", err)
+	}
+	log.Printf("database schema is at version %v", applied[len(applied)-1].Version)
+}
+
+// MigrationStatus prints every known migration along with when it was applied,
+// without modifying the database
+func MigrationStatus(cfg config.Config) {
+	db, err := openReadOnlyDB(cfg)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer db.Close()
+
+	applied, err := db.AppliedMigrations()
+	if err != nil {
+		log.Fatalf("error reading applied migrations: %v", err)
+	}
+	appliedAt := make(map[int]string)
+	version := 0
+	for _, m := range applied {
+		appliedAt[m.Version] = m.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+		version = m.Version
+	}
+
+	fmt.Printf("schema version: %v\n", version)
+	pending := 0
+	migrations := db.Migrations()
+	for _, m := range migrations {
+		status, ok := appliedAt[m.Version]
+		if !ok {
+			status = "pending"
+			pending++
+		}
+		fmt.Printf("  %3v  %-20v %v\n", m.Version, status, m.Description)
+	}
+	if latest := migrations[len(migrations)-1].Version; version > latest {
+		fmt.Printf("warning: the database is at a newer version than the latest known migration %v\n", latest)
+	}
+	fmt.Printf("%v pending migrations\n", pending)
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+)
+
+// inconsistency is a category of the reconcile report
+type inconsistency struct {
+	name    string
+	count   int
+	samples []string
+}
+
+func (c *inconsistency) add(sampleSize int, format string, args ...interface{}) {
+	c.count++
+	if len(c.samples) < sampleSize {
+		c.samples = append(c.samples, fmt.Sprintf(format, args...))
+	}
+}
+
+// Reconcile cross-checks the collected events, the genesis claims records,
+// the decay amounts and the error table, logging a report of the inconsistencies found
+func Reconcile(cfg config.Config, sampleSize int) {
+	// Log to a file to have persistent logs and open the migrated database
+	db, closeAll := setup(cfg, cfg.LogPath)
+	defer closeAll()
+
+	ctx := context.Background()
+	records, err := db.CountClaimsRecords(ctx)
+	if err != nil {
+		log.Fatalf("error reading claims records: %v", err)
+	}
+	if records == 0 {
+		log.Println("warning: claims_record is empty, run import-genesis to check the claims against genesis")
+	}
+
+	checks := []func(context.Context, reconcileStore, int) (*inconsistency, error){
+		claimSendersNotInGenesis,
+		mergedEventsWithoutSender,
+		overClaimedAccounts,
+		doubleClaims,
+		claimSendersWithoutDecayAmount,
+		errorsWithinScannedRange,
+	}
+	report := []*inconsistency{}
+	for _, check := range checks {
+		c, err := check(ctx, db, sampleSize)
+		if err != nil {
+			log.Fatalf("error reconciling: %v", err)
+		}
+		report = append(report, c)
+	}
+
+	log.Println("reconcile report:")
+	total := 0
+	for _, c := range report {
+		total += c.count
+		log.Printf("  %v: %v", c.name, c.count)
+		for _, sample := range c.samples {
+			log.Printf("    %v", sample)
+		}
+	}
+	logSummary("%v inconsistencies found", total)
+}
+
+// claimSendersNotInGenesis reports the claim events whose sender has no genesis claims record
+func claimSendersNotInGenesis(ctx context.Context, db reconcileStore, sampleSize int) (*inconsistency, error) {
+	c := &inconsistency{name: "claim senders missing from genesis"}
+	events, err := db.ClaimEventsWithoutClaimsRecord(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		c.add(sampleSize, "claim_event %v: %v claimed %v at height %v", e.ID, e.Sender, e.Action, e.Height)
+	}
+	return c, nil
+}
+
+// mergedEventsWithoutSender reports the merged events collect-merge-senders did not resolve
+func mergedEventsWithoutSender(ctx context.Context, db reconcileStore, sampleSize int) (*inconsistency, error) {
+	c := &inconsistency{name: "merged events without a resolved sender"}
+	events, err := db.MergedEventsWithoutSender(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		c.add(sampleSize, "merged_event %v: recipient %v at height %v", e.ID, e.Recipient, e.Height)
+	}
+	return c, nil
+}
+
+// overClaimedAccounts reports the accounts whose claims add up to more than their initial claimable amount.
+// Amounts do not fit on sqlite integers so they are added up here.
+func overClaimedAccounts(ctx context.Context, db reconcileStore, sampleSize int) (*inconsistency, error) {
+	c := &inconsistency{name: "accounts claiming more than their initial claimable amount"}
+	initial := make(map[string]*big.Int)
+	claimed := make(map[string]*big.Int)
+	err := db.ForEachClaimEvent(ctx, func(e dblib.ClaimEvent, initialClaimable string) error {
+		if initialClaimable == "" {
+			return nil
+		}
+		if _, ok := initial[e.Sender]; !ok {
+			initial[e.Sender], _ = new(big.Int).SetString(initialClaimable, 10)
+			claimed[e.Sender] = big.NewInt(0)
+		}
+		if a, ok := new(big.Int).SetString(e.Amount, 10); ok {
+			claimed[e.Sender].Add(claimed[e.Sender], a)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	senders := make([]string, 0, len(claimed))
+	for sender := range claimed {
+		senders = append(senders, sender)
+	}
+	sort.Strings(senders)
+	for _, sender := range senders {
+		if initial[sender] != nil && claimed[sender].Cmp(initial[sender]) > 0 {
+			c.add(sampleSize, "%v: claimed %v of %v", sender, claimed[sender], initial[sender])
+		}
+	}
+	return c, nil
+}
+
+// doubleClaims reports the accounts that claimed the same action more than once
+func doubleClaims(ctx context.Context, db reconcileStore, sampleSize int) (*inconsistency, error) {
+	c := &inconsistency{name: "double claims per action"}
+	claims, err := db.DoubleClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range claims {
+		c.add(sampleSize, "%v: %v claimed %v times at heights %v", d.Sender, d.Action, d.Count, d.Heights)
+	}
+	return c, nil
+}
+
+// claimSendersWithoutDecayAmount reports the claim senders calculate-decay-loss did not store a loss for
+func claimSendersWithoutDecayAmount(ctx context.Context, db reconcileStore, sampleSize int) (*inconsistency, error) {
+	c := &inconsistency{name: "claim senders without a decay amount"}
+	senders, err := db.ClaimSendersWithoutDecayAmount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, sender := range senders {
+		c.add(sampleSize, "%v", sender)
+	}
+	return c, nil
+}
+
+// errorsWithinScannedRange reports the unresolved errors of the heights marked as completed on the progress table
+func errorsWithinScannedRange(ctx context.Context, db reconcileStore, sampleSize int) (*inconsistency, error) {
+	c := &inconsistency{name: "unresolved errors within the scanned range"}
+	errs, err := db.UnresolvedErrorsWithinProgress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range errs {
+		eventType := e.EventType
+		if eventType == "" {
+			eventType = "block"
+		}
+		c.add(sampleSize, "error %v: %v at height %v: %v", e.ID, eventType, e.Height, e.Message)
+	}
+	return c, nil
+}
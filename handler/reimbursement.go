@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/facs95/decay-data/coin"
+	"github.com/facs95/decay-data/config"
+	"github.com/facs95/decay-data/decay"
+	"github.com/facs95/decay-data/reimburse"
+)
+
+// manifestFile is the name of the manifest written along with the chunk transactions
+const manifestFile = "manifest.json"
+
+// flaggedAnomalies are the anomalies whose losses are left out of the chunks, as the
+// amounts claimed by the account do not match the ones the losses are calculated from
+const flaggedAnomalies = decay.AnomalyOverClaimed | decay.AnomalyBuggyMismatch
+
+// GenerateReimbursement writes a multi-send transaction for every chunk of the
+// decay losses above the dust and a manifest of the addresses paid on each one.
+// The losses of the accounts with flagged anomalies are only listed on the manifest.
+func GenerateReimbursement(cfg config.Config) {
+	// Log to a file to have persistent logs and open the migrated database
+	db, closeAll := setup(cfg, cfg.LogPath)
+	defer closeAll()
+
+	// An existing manifest means the reimbursement was already generated,
+	// overwriting it could end up paying some addresses twice
+	manifestPath := filepath.Join(cfg.ReimbursementDir, manifestFile)
+	if _, err := os.Stat(manifestPath); err == nil {
+		log.Fatalf("%v already exists, remove it or use another directory", manifestPath)
+	}
+
+	dust, _ := new(big.Int).SetString(cfg.ReimbursementDust, 10)
+	payments, flagged, skipped, err := getPayments(context.Background(), db, dust)
+	if err != nil {
+		log.Fatalf("error reading decay amounts: %v", err)
+	}
+
+	chunks := reimburse.Split(payments, cfg.ReimbursementChunkSize)
+	manifest := reimburse.NewManifest(chunks, cfg.ReimbursementFrom, cfg.ClaimsDenom, dust, cfg.ReimbursementChunkSize, skipped, flagged)
+
+	if err := os.MkdirAll(cfg.ReimbursementDir, 0o755); err != nil {
+		log.Fatalf("error creating reimbursement directory: %v", err)
+	}
+	// Chunks left by an interrupted run are not on the manifest, they are removed so they are not signed by mistake
+	if err := removeChunkFiles(cfg.ReimbursementDir); err != nil {
+		log.Fatalf("error removing previous chunks: %v", err)
+	}
+	for _, chunk := range chunks {
+		tx, err := reimburse.NewTx(chunk, cfg.ReimbursementFrom, cfg.ClaimsDenom, fmt.Sprintf("decay reimbursement %v/%v", chunk.Number, len(chunks)))
+		if err != nil {
+			log.Fatalf("error building chunk %v: %v", chunk.Number, err)
+		}
+		if err := writeJSON(filepath.Join(cfg.ReimbursementDir, reimburse.ChunkFile(chunk)), tx); err != nil {
+			log.Fatalf("error writing chunk %v: %v", chunk.Number, err)
+		}
+	}
+	// The manifest is written last so it only exists once every chunk was written
+	if err := writeJSON(manifestPath, manifest); err != nil {
+		log.Fatalf("error writing manifest: %v", err)
+	}
+
+	total, _ := new(big.Int).SetString(manifest.Total, 10)
+	logSummary("%v payments on %v chunks, %v evmos in total, %v losses not reimbursed and %v flagged for review",
+		manifest.Recipients, len(chunks), coin.NewDecFromAtto(total).Format(cfg.DisplayPrecision), skipped, len(flagged))
+}
+
+// getPayments returns the losses above the dust sorted by address, along with the flagged
+// ones and the amount of losses left out
+func getPayments(ctx context.Context, db decayStore, dust *big.Int) ([]reimburse.Payment, []reimburse.Flagged, int, error) {
+	amounts, err := db.DecayAmounts(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	payments, flagged, skipped := []reimburse.Payment{}, []reimburse.Flagged{}, 0
+	for _, d := range amounts {
+		sender := d.Sender
+		amount, ok := new(big.Int).SetString(d.TotalLost, 10)
+		if !ok || sender == "" {
+			log.Printf("skipping decay amount of %q with invalid total lost %q", sender, d.TotalLost)
+			skipped++
+			continue
+		}
+		if amount.Cmp(dust) <= 0 {
+			skipped++
+			continue
+		}
+		// Unknown anomalies are flagged too
+		anomalies, err := decay.ParseAnomalies(d.Anomalies)
+		if err != nil || anomalies&flaggedAnomalies != 0 {
+			flagged = append(flagged, reimburse.Flagged{Address: sender, Amount: amount.String(), Anomalies: d.Anomalies})
+			continue
+		}
+		payments = append(payments, reimburse.Payment{Address: sender, Amount: amount})
+	}
+	return payments, flagged, skipped, nil
+}
+
+// removeChunkFiles removes the chunk transactions on dir
+func removeChunkFiles(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, reimburse.ChunkFilePattern))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		log.Printf("removing %v of a previous run", f)
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
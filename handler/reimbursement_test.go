@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/reimburse"
+)
+
+func TestGetPayments(t *testing.T) {
+	db := newFakeStore()
+	db.decayAmounts = []dblib.DecayAmount{
+		{Sender: "evmos1a", TotalLost: "100"},
+		{Sender: "evmos1b", TotalLost: "10"},
+		{Sender: "evmos1c", TotalLost: "200", Anomalies: "over_claimed"},
+		{Sender: "evmos1d", TotalLost: "300", Anomalies: "double_claim,buggy_mismatch"},
+		{Sender: "evmos1e", TotalLost: "400", Anomalies: "double_claim"},
+		{Sender: "evmos1f", TotalLost: "500", Anomalies: "lucky"},
+		{Sender: "evmos1g", TotalLost: "5", Anomalies: "over_claimed"},
+		{Sender: "evmos1h", TotalLost: "-40"},
+		{Sender: "evmos1i", TotalLost: ""},
+		{Sender: "", TotalLost: "100"},
+	}
+
+	payments, flagged, skipped, err := getPayments(context.Background(), db, big.NewInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 2 || payments[0].Address != "evmos1a" || payments[1].Address != "evmos1e" || payments[1].Amount.Int64() != 400 {
+		t.Errorf("got payments %+v, want the ones of evmos1a and evmos1e", payments)
+	}
+	want := []reimburse.Flagged{
+		{Address: "evmos1c", Amount: "200", Anomalies: "over_claimed"},
+		{Address: "evmos1d", Amount: "300", Anomalies: "double_claim,buggy_mismatch"},
+		{Address: "evmos1f", Amount: "500", Anomalies: "lucky"},
+	}
+	if len(flagged) != len(want) {
+		t.Fatalf("got flagged %+v, want %+v", flagged, want)
+	}
+	for i := range want {
+		if flagged[i] != want[i] {
+			t.Errorf("flagged %v: got %+v, want %+v", i, flagged[i], want[i])
+		}
+	}
+	// The losses up to the dust and the invalid ones
+	if skipped != 5 {
+		t.Errorf("got %v losses skipped, want 5", skipped)
+	}
+}
+
+func TestRemoveChunkFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"chunk-0001.json", "chunk-0002.json", "notes.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := removeChunkFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	left, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(left) != 1 || filepath.Base(left[0]) != "notes.json" {
+		t.Errorf("got files %v, want only notes.json", left)
+	}
+}
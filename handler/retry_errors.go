@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/query"
+)
+
+// RetryErrors queries again the heights stored on the error table and runs them
+// through the same filter and insert path used by CollectEvents
+func RetryErrors(cfg config.Config, source query.Source) {
+	// Log to a file to have persistent logs and open the migrated database
+	db, closeAll := setup(cfg, cfg.LogPath)
+	defer closeAll()
+
+	filter, err := newEventFilter(cfg.EventRules, cfg.ClaimsDenom)
+	if err != nil {
+		log.Fatalf("error loading event rules: %v", err)
+	}
+
+	// Set up context cancelled on shutdown signals
+	ctx, stop, cancel := withShutdown()
+	defer cancel()
+
+	errs, err := getUnresolvedErrors(ctx, db, filter)
+	if err != nil {
+		log.Fatalf("error reading unresolved errors: %v", err)
+	}
+	log.Printf("total unresolved errors to retry: %v", len(errs))
+
+	if err := retryWorkers(ctx, stop, db, source, filter, errs, cfg.BatchSize, cfg.MaxWorkers); err != nil {
+		log.Fatalf("error retrying errors: %v", err)
+	}
+
+	if reporter, ok := source.(query.StatsReporter); ok {
+		reporter.ReportStats()
+	}
+	log.Println("Job finished")
+}
+
+// getUnresolvedErrors returns the error rows that were not resolved yet ordered by height.
+// Only failed heights and errors of the events captured by the filter are returned.
+func getUnresolvedErrors(ctx context.Context, db eventStore, filter *eventFilter) ([]dblib.Error, error) {
+	unresolved, err := db.UnresolvedErrors(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := []dblib.Error{}
+	for _, e := range unresolved {
+		if _, ok := filter.rules[e.EventType]; e.EventType != "" && !ok {
+			continue
+		}
+		errs = append(errs, e)
+	}
+	return errs, nil
+}
+
+func retryWorkers(ctx context.Context, stop <-chan struct{}, db eventStore, source query.Source, filter *eventFilter, errs []dblib.Error, batchSize int, maxWorkers int) error {
+	summary := newRunSummary("heights")
+	times := blockTimes{store: db, source: source}
+
+	// Create a channel to hold jobs to be executed by workers
+	jobs := make(chan []dblib.Error, maxWorkers)
+	// Create a WaitGroup to wait for all workers to complete
+	wg := sync.WaitGroup{}
+
+	// Launch worker goroutines
+	for i := 0; i < maxWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for job := range jobs {
+				// Jobs already queued are not started once shutting down
+				if stopped(stop) {
+					summary.skip(job[0].Height, job[len(job)-1].Height)
+					continue
+				}
+
+				log.Printf("starting worker %v with errors %v-%v", i, job[0].ID, job[len(job)-1].ID)
+				mergedEvents, claimEvents, newBlockTimes, retried, newErrors := processBatchOfErrors(ctx, source, times, filter, job)
+
+				if err := updateRetriedErrors(ctx, db, claimEvents, mergedEvents, newBlockTimes, retried, newErrors); err != nil {
+					log.Printf("error inserting into database: %v", err)
+					summary.fail(job[0].Height, job[len(job)-1].Height)
+					continue
+				}
+				summary.complete()
+				log.Printf("finished worker %v", i)
+			}
+		}(i)
+	}
+
+	// Generate jobs for each batch and send them to the jobs channel
+	// errors are ordered by height so rows of the same height always land on the same batch
+	for i := 0; i < len(errs); {
+		end := i + batchSize
+		if end > len(errs) {
+			end = len(errs)
+		}
+		for end < len(errs) && errs[end].Height == errs[end-1].Height {
+			end++
+		}
+
+		select {
+		case jobs <- errs[i:end]:
+		case <-stop:
+			summary.skip(errs[i].Height, errs[end-1].Height)
+		}
+		i = end
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	summary.report()
+	return nil
+}
+
+// processBatchOfErrors queries again the height of every error and returns the events found.
+// The returned errors are flagged as resolved when their height could be queried and
+// their event, if any, could be decoded. Events still failing that had no error yet are returned as new errors.
+func processBatchOfErrors(ctx context.Context, source query.BlockSource, times blockTimes, filter *eventFilter, errs []dblib.Error) ([]dblib.MergedEvent, []dblib.ClaimEvent, []dblib.BlockTime, []dblib.Error, []dblib.Error) {
+	mergedEvents, claimEvents, newBlockTimes, retried, newErrors := []dblib.MergedEvent{}, []dblib.ClaimEvent{}, []dblib.BlockTime{}, []dblib.Error{}, []dblib.Error{}
+	for i := 0; i < len(errs); {
+		// query each height only once even if it failed several times
+		height := errs[i].Height
+		end := i
+		for end < len(errs) && errs[end].Height == height {
+			end++
+		}
+
+		blockResult, err := source.GetBlockResult(ctx, height)
+		if ctx.Err() != nil {
+			log.Printf("stopped retrying errors at height %v: %v", height, ctx.Err())
+			break
+		}
+
+		// events of the block that still fail, by tx and event index
+		failing := make(map[string]dblib.Error)
+		if err != nil {
+			log.Printf("error querying external resource at height %v: %v", height, err)
+		} else {
+			merged, claims, eventErrors := filter.filterAndDecodeEvents(blockResult.Result.TxsResults, height)
+			var blockTime []dblib.BlockTime
+			blockTime, err = times.stampEvents(ctx, height, merged, claims)
+			if ctx.Err() != nil {
+				log.Printf("stopped retrying errors at height %v: %v", height, ctx.Err())
+				break
+			}
+			if err != nil {
+				log.Printf("error querying external resource at height %v: %v", height, err)
+			} else {
+				mergedEvents = append(mergedEvents, merged...)
+				claimEvents = append(claimEvents, claims...)
+				newBlockTimes = append(newBlockTimes, blockTime...)
+				for _, e := range eventErrors {
+					failing[e.TxIndex+"/"+e.EventIndex] = e
+				}
+			}
+		}
+
+		for _, e := range errs[i:end] {
+			key := e.TxIndex + "/" + e.EventIndex
+			_, stillFailing := failing[key]
+			e.Resolved = err == nil && !(e.EventType != "" && stillFailing)
+			retried = append(retried, e)
+			if e.EventType != "" {
+				delete(failing, key)
+			}
+		}
+		for _, e := range failing {
+			newErrors = append(newErrors, e)
+		}
+		i = end
+	}
+	return mergedEvents, claimEvents, newBlockTimes, retried, newErrors
+}
+
+// updateRetriedErrors stores the recovered events, updates the retried errors
+// and inserts the new ones within a single transaction
+func updateRetriedErrors(ctx context.Context, db eventStore, claimEvents []dblib.ClaimEvent, mergedEvents []dblib.MergedEvent, blockTimes []dblib.BlockTime, retried []dblib.Error, newErrors []dblib.Error) error {
+	err := db.InsertEvents(ctx, dblib.EventBatch{
+		Claims:     claimEvents,
+		Merged:     mergedEvents,
+		BlockTimes: blockTimes,
+		Errors:     newErrors,
+		Retried:    retried,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range retried {
+		if !e.Resolved {
+			log.Printf("height %v is still failing after %v attempts", e.Height, e.Attempts+1)
+		}
+	}
+	return nil
+}
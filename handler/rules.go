@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/facs95/decay-data/coin"
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/query"
+)
+
+// ruleTableColumns lists the columns that the rules storing on each table have to map
+var ruleTableColumns = map[string][]string{
+	"merged_event": {"recipient", "claimed_coins", "fund_community_pool_coins"},
+	"claim_event":  {"sender", "amount", "claim_action"},
+}
+
+// ruleCoinColumns are the columns holding coins, they are stored as an amount of the claims denom
+var ruleCoinColumns = map[string]bool{
+	"claimed_coins":             true,
+	"fund_community_pool_coins": true,
+	"amount":                    true,
+}
+
+// eventFilter selects and decodes the events matching the configured rules
+type eventFilter struct {
+	// rules indexed by event type
+	rules map[string][]config.EventRule
+	// denom of the coins stored
+	denom string
+}
+
+// newEventFilter validates the rules and returns a filter for them
+// storing the coins amounts of the given denom
+func newEventFilter(rules []config.EventRule, denom string) (*eventFilter, error) {
+	f := &eventFilter{rules: make(map[string][]config.EventRule), denom: denom}
+	for _, rule := range rules {
+		columns, ok := ruleTableColumns[rule.Table]
+		if !ok {
+			return nil, fmt.Errorf("unknown table %q on rule for event %q", rule.Table, rule.Event)
+		}
+		for _, column := range columns {
+			if rule.Columns[column] == "" {
+				return nil, fmt.Errorf("missing column %q on rule for event %q", column, rule.Event)
+			}
+		}
+		for column := range rule.Columns {
+			if !contains(columns, column) {
+				return nil, fmt.Errorf("unknown column %q of table %q on rule for event %q", column, rule.Table, rule.Event)
+			}
+		}
+		f.rules[rule.Event] = append(f.rules[rule.Event], rule)
+	}
+	return f, nil
+}
+
+// filterAndDecodeEvents returns the events of the block txs matching the rules
+// and an error for each matching event that could not be decoded
+func (f *eventFilter) filterAndDecodeEvents(txs []query.ResponseDeliverTx, height int) ([]dblib.MergedEvent, []dblib.ClaimEvent, []dblib.Error) {
+	mergedEvents, claimEvents, eventErrors := []dblib.MergedEvent{}, []dblib.ClaimEvent{}, []dblib.Error{}
+	//  Iterate over all txs in the block
+	for i := range txs {
+		// Iterate over all events in tx
+		for index := range txs[i].Events {
+			rules, ok := f.rules[txs[i].Events[index].Type]
+			if !ok {
+				continue
+			}
+
+			v := txs[i].Events[index]
+			// Decode the attributes
+			err := v.DecodeAttributes()
+			if err != nil {
+				log.Printf("error decoding resource at height %v: %v", height, err)
+				eventErrors = append(eventErrors, newEventError(height, i, index, v.Type, err))
+				continue
+			}
+
+			for _, rule := range rules {
+				if !matches(rule, v) {
+					continue
+				}
+				values, err := f.ruleValues(rule, v)
+				if err != nil {
+					log.Printf("error mapping %v event at height %v tx %v event %v: %v", v.Type, height, i, index, err)
+					eventErrors = append(eventErrors, newEventError(height, i, index, v.Type, err))
+					continue
+				}
+
+				switch rule.Table {
+				case "merged_event":
+					mergedEvents = append(mergedEvents, dblib.MergedEvent{
+						Height:                 height,
+						TxIndex:                i,
+						EventIndex:             index,
+						Recipient:              values["recipient"],
+						ClaimedCoins:           values["claimed_coins"],
+						ClaimedDenom:           f.denom,
+						FundCommunityPool:      values["fund_community_pool_coins"],
+						FundCommunityPoolDenom: f.denom,
+					})
+				case "claim_event":
+					claimEvents = append(claimEvents, dblib.ClaimEvent{
+						Height:     height,
+						TxIndex:    i,
+						EventIndex: index,
+						Sender:     values["sender"],
+						Amount:     values["amount"],
+						Denom:      f.denom,
+						Action:     values["claim_action"],
+					})
+				}
+			}
+		}
+	}
+	return mergedEvents, claimEvents, eventErrors
+}
+
+// newEventError returns the error table row for an event that could not be processed
+func newEventError(height, txIndex, eventIndex int, eventType string, err error) dblib.Error {
+	return dblib.Error{
+		Height:     height,
+		EventType:  eventType,
+		TxIndex:    strconv.Itoa(txIndex),
+		EventIndex: strconv.Itoa(eventIndex),
+		Message:    err.Error(),
+	}
+}
+
+// matches reports whether the event has every attribute value required by the rule
+func matches(rule config.EventRule, event query.Event) bool {
+	for key, expected := range rule.Where {
+		value, err := event.Attribute(key)
+		if err != nil || value != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleValues maps the event attributes to the rule columns
+// replacing the coins by their amount of the filter denom
+func (f *eventFilter) ruleValues(rule config.EventRule, event query.Event) (map[string]string, error) {
+	values := make(map[string]string, len(rule.Columns))
+	for column, key := range rule.Columns {
+		value, err := event.Attribute(key)
+		if err != nil {
+			return nil, err
+		}
+		if ruleCoinColumns[column] {
+			value, err = f.amountOf(value)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %q: %v", key, err)
+			}
+		}
+		values[column] = value
+	}
+	return values, nil
+}
+
+// amountOf returns the amount of the filter denom within the coins.
+// Coins of other denoms are not expected on claims events, they are logged and
+// the coins are rejected if they hold no amount of the filter denom at all.
+func (f *eventFilter) amountOf(value string) (string, error) {
+	coins, err := coin.ParseCoins(value)
+	if err != nil {
+		return "", err
+	}
+	amount := coins.AmountOf(f.denom)
+	if len(coins) > 0 && amount.Sign() == 0 {
+		return "", fmt.Errorf("no %v on coins %q", f.denom, value)
+	}
+	if len(coins) > 1 {
+		log.Printf("ignoring coins other than %v on %q", f.denom, value)
+	}
+	return amount.String(), nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// errStopped interrupts a read of the database once shutting down
+var errStopped = errors.New("stopped")
+
+// withShutdown returns a context and a stop channel wired to SIGINT/SIGTERM.
+// The first signal closes stop so no new jobs are dispatched while the in-flight ones finish,
+// a second signal cancels the context aborting them and rolling back their transactions.
+func withShutdown() (context.Context, <-chan struct{}, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan struct{})
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Printf("received %v, waiting for in-flight jobs to finish. Send it again to abort them", sig)
+			close(stop)
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case sig := <-signals:
+			log.Printf("received %v, aborting in-flight jobs", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, stop, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// stopped reports whether the stop channel was closed
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// runSummary keeps track of the jobs of a run so what was and wasn't processed can be reported on exit.
+// Jobs are identified by their first and last item, e.g. block heights or event ids.
+type runSummary struct {
+	mu        sync.Mutex
+	unit      string
+	completed int
+	failed    [][]int
+	skipped   [][]int
+}
+
+func newRunSummary(unit string) *runSummary {
+	return &runSummary{unit: unit}
+}
+
+func (s *runSummary) complete() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completed++
+}
+
+func (s *runSummary) fail(from, to int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = append(s.failed, []int{from, to})
+}
+
+func (s *runSummary) skip(from, to int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipped = append(s.skipped, []int{from, to})
+}
+
+func (s *runSummary) report() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.Slice(s.failed, func(i, j int) bool { return s.failed[i][0] < s.failed[j][0] })
+	sort.Slice(s.skipped, func(i, j int) bool { return s.skipped[i][0] < s.skipped[j][0] })
+	logSummary("%v jobs completed, %v failed, %v not processed", s.completed, len(s.failed), len(s.skipped))
+	for _, r := range s.failed {
+		log.Printf("  failed %v %v-%v", s.unit, r[0], r[1])
+	}
+	for _, r := range s.skipped {
+		log.Printf("  not processed %v %v-%v", s.unit, r[0], r[1])
+	}
+}
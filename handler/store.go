@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+)
+
+// eventStore stores the events of collect-events and retry-errors
+type eventStore interface {
+	InsertEvents(ctx context.Context, batch dblib.EventBatch) error
+	CompletedRanges(ctx context.Context) ([]dblib.Progress, error)
+	UnresolvedErrors(ctx context.Context) ([]dblib.Error, error)
+	blockTimeStore
+}
+
+// blockTimeStore caches the time of the blocks
+type blockTimeStore interface {
+	BlockTime(ctx context.Context, height int) (time.Time, bool, error)
+}
+
+// mergeSenderStore resolves the IBC sender of the merged events
+type mergeSenderStore interface {
+	MergedEventsWithoutSender(ctx context.Context) ([]dblib.MergedEvent, error)
+	UpdateMergeSenders(ctx context.Context, events []dblib.MergedEvent, errs []dblib.Error) error
+}
+
+// claimsStore holds the genesis claims records and params
+type claimsStore interface {
+	ImportClaims(ctx context.Context, fn func(w dblib.ClaimsWriter) error) error
+	ClaimsParams(ctx context.Context) (dblib.ClaimsParams, error)
+	ClaimsRecord(ctx context.Context, address string) (dblib.ClaimsRecord, error)
+	CountClaimsRecords(ctx context.Context) (int, error)
+}
+
+// decayStore reads the events and stores the losses of calculate-decay-loss
+type decayStore interface {
+	claimsStore
+	blockTimeStore
+	HeightsWithoutBlockTime(ctx context.Context) ([]int, error)
+	SetEventBlockTimes(ctx context.Context, times []dblib.BlockTime) error
+	ForEachClaimEvent(ctx context.Context, fn func(event dblib.ClaimEvent, initialClaimable string) error) error
+	ForEachMergedEvent(ctx context.Context, fn func(event dblib.MergedEvent) error) error
+	UpsertDecayAmounts(ctx context.Context, amounts []dblib.DecayAmount) error
+	DecayAmounts(ctx context.Context) ([]dblib.DecayAmount, error)
+}
+
+// reconcileStore reads the tables cross-checked by reconcile
+type reconcileStore interface {
+	decayStore
+	mergeSenderStore
+	ClaimEventsWithoutClaimsRecord(ctx context.Context) ([]dblib.ClaimEvent, error)
+	DoubleClaims(ctx context.Context) ([]dblib.DoubleClaim, error)
+	ClaimSendersWithoutDecayAmount(ctx context.Context) ([]string, error)
+	UnresolvedErrorsWithinProgress(ctx context.Context) ([]dblib.Error, error)
+}
+
+// migrationStore applies the versioned schema migrations of its backend
+type migrationStore interface {
+	Migrate(claimsDenom string) ([]dblib.Migration, error)
+	AppliedMigrations() ([]dblib.AppliedMigration, error)
+	Migrations() []dblib.Migration
+}
+
+// Store is the storage used by the handlers, the interfaces each handler depends on
+// can be faked to run it without a database
+type Store interface {
+	eventStore
+	reconcileStore
+	migrationStore
+	exportStore
+	importStore
+	Close() error
+}
+
+var _ Store = (*dblib.DB)(nil)
+
+// openDB opens the configured database without migrating it, a postgres connection url
+// selects the postgres backend and anything else is the path of a sqlite database
+func openDB(cfg config.Config) (Store, error) {
+	if dblib.IsPostgresDSN(cfg.DBPath) {
+		return dblib.OpenPostgres(cfg.DBPath)
+	}
+	return dblib.Open(cfg.DBPath)
+}
+
+// openReadOnlyDB opens the configured database to read it, a sqlite database must exist
+func openReadOnlyDB(cfg config.Config) (Store, error) {
+	if dblib.IsPostgresDSN(cfg.DBPath) {
+		return dblib.OpenPostgres(cfg.DBPath)
+	}
+	return dblib.OpenReadOnly(cfg.DBPath)
+}
+
+// openStore opens the configured database applying its pending migrations,
+// stopping the command if it fails
+func openStore(cfg config.Config) Store {
+	db, err := openDB(cfg)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	applied, err := db.Migrate(cfg.ClaimsDenom)
+	for _, m := range applied {
+		log.Printf("applied migration %v: %v", m.Version, m.Description)
+	}
+	if err != nil {
+		db.Close()
+		log.Fatalf("error migrating database: %v", err)
+	}
+	return db
+}
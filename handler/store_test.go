@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	dblib "github.com/facs95/decay-data/db"
+)
+
+// fakeStore is an in-memory store of the claims, events and block times the handlers read and write
+type fakeStore struct {
+	mu           sync.Mutex
+	params       *dblib.ClaimsParams
+	records      map[string]dblib.ClaimsRecord
+	blockTimes   map[int]time.Time
+	claims       []dblib.ClaimEvent
+	merged       []dblib.MergedEvent
+	errors       []dblib.Error
+	progress     []dblib.Progress
+	decayAmounts []dblib.DecayAmount
+	// upsertErr is returned by UpsertDecayAmounts
+	upsertErr error
+}
+
+var (
+	_ decayStore = (*fakeStore)(nil)
+	_ eventStore = (*fakeStore)(nil)
+)
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		records:    make(map[string]dblib.ClaimsRecord),
+		blockTimes: make(map[int]time.Time),
+	}
+}
+
+func (s *fakeStore) InsertEvents(ctx context.Context, batch dblib.EventBatch) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claims = append(s.claims, batch.Claims...)
+	s.merged = append(s.merged, batch.Merged...)
+	for _, t := range batch.BlockTimes {
+		s.blockTimes[t.Height] = t.Time
+	}
+	for _, retried := range batch.Retried {
+		for i := range s.errors {
+			if s.errors[i].ID == retried.ID {
+				s.errors[i] = retried
+			}
+		}
+	}
+	for _, e := range batch.Errors {
+		e.ID = len(s.errors) + 1
+		s.errors = append(s.errors, e)
+	}
+	if batch.Progress != nil {
+		s.progress = append(s.progress, *batch.Progress)
+	}
+	return nil
+}
+
+func (s *fakeStore) CompletedRanges(ctx context.Context) ([]dblib.Progress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	completed := append([]dblib.Progress{}, s.progress...)
+	sort.Slice(completed, func(i, j int) bool { return completed[i].FromHeight < completed[j].FromHeight })
+	return completed, nil
+}
+
+func (s *fakeStore) UnresolvedErrors(ctx context.Context) ([]dblib.Error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unresolved := []dblib.Error{}
+	for _, e := range s.errors {
+		if !e.Resolved {
+			unresolved = append(unresolved, e)
+		}
+	}
+	return unresolved, nil
+}
+
+func (s *fakeStore) BlockTime(ctx context.Context, height int) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.blockTimes[height]
+	return t, ok, nil
+}
+
+func (s *fakeStore) ImportClaims(ctx context.Context, fn func(w dblib.ClaimsWriter) error) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (s *fakeStore) ClaimsParams(ctx context.Context) (dblib.ClaimsParams, error) {
+	if s.params == nil {
+		return dblib.ClaimsParams{}, sql.ErrNoRows
+	}
+	return *s.params, nil
+}
+
+func (s *fakeStore) ClaimsRecord(ctx context.Context, address string) (dblib.ClaimsRecord, error) {
+	record, ok := s.records[address]
+	if !ok {
+		return dblib.ClaimsRecord{}, sql.ErrNoRows
+	}
+	return record, nil
+}
+
+func (s *fakeStore) CountClaimsRecords(ctx context.Context) (int, error) {
+	return len(s.records), nil
+}
+
+func (s *fakeStore) HeightsWithoutBlockTime(ctx context.Context) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[int]bool)
+	for _, e := range s.claims {
+		if e.BlockTime.IsZero() {
+			seen[e.Height] = true
+		}
+	}
+	for _, e := range s.merged {
+		if e.BlockTime.IsZero() {
+			seen[e.Height] = true
+		}
+	}
+	heights := []int{}
+	for height := range seen {
+		heights = append(heights, height)
+	}
+	sort.Ints(heights)
+	return heights, nil
+}
+
+func (s *fakeStore) SetEventBlockTimes(ctx context.Context, times []dblib.BlockTime) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range times {
+		s.blockTimes[t.Height] = t.Time
+		for i := range s.claims {
+			if s.claims[i].Height == t.Height {
+				s.claims[i].BlockTime = t.Time
+			}
+		}
+		for i := range s.merged {
+			if s.merged[i].Height == t.Height {
+				s.merged[i].BlockTime = t.Time
+			}
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) ForEachClaimEvent(ctx context.Context, fn func(event dblib.ClaimEvent, initialClaimable string) error) error {
+	for _, e := range s.claims {
+		if err := fn(e, s.records[e.Sender].InitialClaimableAmount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) ForEachMergedEvent(ctx context.Context, fn func(event dblib.MergedEvent) error) error {
+	for _, e := range s.merged {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) UpsertDecayAmounts(ctx context.Context, amounts []dblib.DecayAmount) error {
+	if s.upsertErr != nil {
+		return s.upsertErr
+	}
+	s.decayAmounts = append(s.decayAmounts, amounts...)
+	return nil
+}
+
+func (s *fakeStore) DecayAmounts(ctx context.Context) ([]dblib.DecayAmount, error) {
+	return s.decayAmounts, nil
+}
+
+// fakeBlockTimes is a block time source answering the heights it holds and failing the rest
+type fakeBlockTimes map[int]time.Time
+
+func (f fakeBlockTimes) GetBlockTime(ctx context.Context, height int) (time.Time, error) {
+	t, ok := f[height]
+	if !ok {
+		return time.Time{}, fmt.Errorf("block %v not found", height)
+	}
+	return t, nil
+}
@@ -1,38 +1,325 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
+	"github.com/facs95/decay-data/config"
+	dblib "github.com/facs95/decay-data/db"
+	"github.com/facs95/decay-data/export"
 	"github.com/facs95/decay-data/handler"
+	"github.com/facs95/decay-data/query"
 )
 
+// errUsage is returned when the command line is invalid, the usage was already printed
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"collect-events", "Collect merge_claims_records and claim events within a block range", runCollectEvents},
+	{"collect-merge-senders", "Resolve the IBC sender of the merged events without one", runCollectMergeSenders},
+	{"retry-errors", "Query again the heights stored on the error table", runRetryErrors},
+	{"import-genesis", "Store the genesis claims records and params on the database", runImportGenesis},
+	{"calculate-decay-loss", "Calculate the amount lost by every claiming account", runCalculateDecayLoss},
+	{"reconcile", "Report the inconsistencies between the events, genesis, decay amounts and errors", runReconcile},
+	{"generate-reimbursement", "Write the multi-send transactions paying back the decay losses", runGenerateReimbursement},
+	{"migrate", "Apply the pending database migrations, or list them with 'migrate status'", runMigrate},
+	{"export", "Write a table or a query result as CSV, JSON Lines or Parquet", runExport},
+	{"import", "Load claim events, merged events or block times from a CSV file", runImport},
+}
+
 func main() {
-	if len(os.Args) == 1 {
-		panic("No arguments provided. Please provide either 'collect-events' or 'collect-merge-senders'")
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		printUsage()
+		return 2
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage()
+		return 0
 	}
 
-	if os.Args[1] == "collect-events" {
-		if len(os.Args) != 4 {
-			panic("Not enough arguments provided. Please provide block range to query")
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
 		}
-
-		fromBlock, err := strconv.Atoi(os.Args[2])
-		if err != nil {
-			panic("fromBlock is not a number")
+		err := cmd.run(args[1:])
+		switch {
+		case err == nil, errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		default:
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
 		}
+	}
+
+	fmt.Fprintf(os.Stderr, "error: unknown command %q\n\n", args[0])
+	printUsage()
+	return 2
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: decay-data <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-24v %v\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'decay-data <command> --help' for the flags of each command.")
+}
+
+func runCollectEvents(args []string) error {
+	fs := newFlagSet("collect-events", "[<from> <to>]", "Collect merge_claims_records and claim events between the from and to blocks, both included.\nCompleted batches of previous runs are skipped.", "db", "log", "rpc", "blocks-dir", "batch-size", "workers")
+	fromBlock := fs.Int("from", 0, "first block to query")
+	toBlock := fs.Int("to", 0, "last block to query")
+	cfg, err := fs.load(args)
+	if err != nil {
+		return err
+	}
 
-		toBlock, err := strconv.Atoi(os.Args[3])
-		if err != nil {
-			panic("toBlock is not a number")
+	// The range can also be provided as positional arguments
+	if fs.NArg() != 0 {
+		if fs.NArg() != 2 {
+			return fs.usageErr("expected <from> and <to> blocks, got %v arguments", fs.NArg())
 		}
+		if *fromBlock, err = strconv.Atoi(fs.Arg(0)); err != nil {
+			return fs.usageErr("from block %q is not a number", fs.Arg(0))
+		}
+		if *toBlock, err = strconv.Atoi(fs.Arg(1)); err != nil {
+			return fs.usageErr("to block %q is not a number", fs.Arg(1))
+		}
+	}
+	if *fromBlock <= 0 || *toBlock <= 0 {
+		return fs.usageErr("a positive from and to block are required")
+	}
+	if *fromBlock > *toBlock {
+		return fs.usageErr("from block %v is greater than to block %v", *fromBlock, *toBlock)
+	}
 
-		handler.CollectEvents(fromBlock, toBlock)
-	} else if os.Args[1] == "collect-merge-senders" {
-		handler.CollectMergeSenders()
-	} else if os.Args[1] == "calculate-decay-loss" {
-		handler.DecayLostAmounts()
+	source, err := newBlockSource(cfg)
+	if err != nil {
+		return err
+	}
+	handler.CollectEvents(cfg, source, *fromBlock, *toBlock)
+	return nil
+}
+
+func runCollectMergeSenders(args []string) error {
+	fs := newFlagSet("collect-merge-senders", "", "Query the block of every merged event without a sender and store the IBC sender of the merge.", "db", "log", "rpc", "blocks-dir", "batch-size", "workers")
+	cfg, err := fs.loadNoArgs(args)
+	if err != nil {
+		return err
+	}
+
+	source, err := newBlockSource(cfg)
+	if err != nil {
+		return err
+	}
+	handler.CollectMergeSenders(cfg, source)
+	return nil
+}
+
+func runRetryErrors(args []string) error {
+	fs := newFlagSet("retry-errors", "", "Query again the unresolved heights of the error table, storing their events.", "db", "log", "rpc", "blocks-dir", "batch-size", "workers")
+	cfg, err := fs.loadNoArgs(args)
+	if err != nil {
+		return err
+	}
+
+	source, err := newBlockSource(cfg)
+	if err != nil {
+		return err
+	}
+	handler.RetryErrors(cfg, source)
+	return nil
+}
+
+func runImportGenesis(args []string) error {
+	fs := newFlagSet("import-genesis", "", "Store the claims records and params of the genesis on the claims_record and claims_params tables,\nreplacing any previous import.", "db", "log", "genesis")
+	cfg, err := fs.loadNoArgs(args)
+	if err != nil {
+		return err
+	}
+
+	handler.ImportGenesis(cfg)
+	return nil
+}
+
+func runCalculateDecayLoss(args []string) error {
+	fs := newFlagSet("calculate-decay-loss", "", "Calculate the amount lost by every account on the claim_event table using the claims records\nand the decay schedule imported by import-genesis at the time of each claim.", "db", "decay-log", "rpc", "blocks-dir", "workers", "precision")
+	cfg, err := fs.loadNoArgs(args)
+	if err != nil {
+		return err
+	}
+
+	source, err := newBlockSource(cfg)
+	if err != nil {
+		return err
+	}
+	handler.DecayLostAmounts(cfg, source)
+	return nil
+}
+
+func runReconcile(args []string) error {
+	fs := newFlagSet("reconcile", "", "Cross-check the collected events, the genesis claims records, the decay amounts and the error table,\nreporting the inconsistencies found by category.", "db", "log")
+	samples := fs.Int("samples", 5, "sample rows reported per category")
+	cfg, err := fs.loadNoArgs(args)
+	if err != nil {
+		return err
+	}
+	if *samples < 0 {
+		return fs.usageErr("samples can not be negative, got %v", *samples)
+	}
+
+	handler.Reconcile(cfg, *samples)
+	return nil
+}
+
+func runGenerateReimbursement(args []string) error {
+	fs := newFlagSet("generate-reimbursement", "", "Write a bank multi-send transaction for every chunk of the losses on the decay_amount table\nalong with a manifest of the addresses paid on each chunk.", "db", "log", "reimbursement", "precision")
+	cfg, err := fs.loadNoArgs(args)
+	if err != nil {
+		return err
+	}
+	if cfg.ReimbursementFrom == "" {
+		return fs.usageErr("the address paying the reimbursements is required")
+	}
+
+	handler.GenerateReimbursement(cfg)
+	return nil
+}
+
+func runMigrate(args []string) error {
+	fs := newFlagSet("migrate", "[status]", "Apply the pending schema migrations to the database. Every other command also applies them on startup.\nWith status, list the migrations and whether they were applied without modifying the database.", "db", "log")
+	// status is accepted both before and after the flags
+	status := len(args) > 0 && args[0] == "status"
+	if status {
+		args = args[1:]
+	}
+	cfg, err := fs.load(args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case fs.NArg() == 1 && fs.Arg(0) == "status" && !status:
+		status = true
+	case fs.NArg() != 0:
+		return fs.usageErr("unexpected arguments %q", fs.Args())
+	}
+	if status {
+		handler.MigrationStatus(cfg)
 	} else {
-		panic("Invalid argument provided. Please provide either 'collect-events' or 'collect-merge-senders'")
+		handler.Migrate(cfg)
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	fs := newFlagSet("export", "[<table>]", "Write the rows of a table, or of the --query result, sorted by the table key or by every column of the query.\nThe tables are error, merged_event, claim_event, decay_amount, progress, block_time, claims_record and claims_params.", "db", "log")
+	format := fs.String("format", "csv", fmt.Sprintf("output format, one of %v", strings.Join(export.Formats, ", ")))
+	out := fs.String("out", "", "file the rows are written to, stdout when empty")
+	query := fs.String("query", "", "select statement to export instead of a table")
+	columns := fs.String("columns", "", "comma separated columns to export, all when empty")
+	orderBy := fs.String("order-by", "", "comma separated columns to sort the rows by before the table key")
+	fromHeight := fs.Int("from-height", 0, "first height exported")
+	toHeight := fs.Int("to-height", 0, "last height exported")
+	// the table is accepted both before and after the flags
+	table := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		table, args = args[0], args[1:]
+	}
+	cfg, err := fs.load(args)
+	if err != nil {
+		return err
+	}
+	if table == "" && fs.NArg() == 1 {
+		table = fs.Arg(0)
+	} else if fs.NArg() != 0 {
+		return fs.usageErr("unexpected arguments %q", fs.Args())
+	}
+
+	e := dblib.Export{
+		Query:      *query,
+		Columns:    config.SplitList(*columns),
+		OrderBy:    config.SplitList(*orderBy),
+		FromHeight: *fromHeight,
+		ToHeight:   *toHeight,
+	}
+	switch {
+	case table != "" && e.Query == "":
+		e.Table = table
+	case table == "" && e.Query != "":
+	default:
+		return fs.usageErr("expected either a table or --query")
+	}
+	if e.FromHeight < 0 || e.ToHeight < 0 {
+		return fs.usageErr("heights can not be negative")
+	}
+	if e.ToHeight != 0 && e.FromHeight > e.ToHeight {
+		return fs.usageErr("from height %v is greater than to height %v", e.FromHeight, e.ToHeight)
+	}
+	if !contains(export.Formats, *format) {
+		return fs.usageErr("unknown format %q, expected one of %v", *format, strings.Join(export.Formats, ", "))
+	}
+
+	handler.Export(cfg, e, *format, *out)
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := newFlagSet("import", "<table> <file>", fmt.Sprintf("Load the rows of a CSV file with a header, as written by export, into the table, one of %v.\nCoins can be raw, e.g. 100aevmos, or amounts of the claims denom. Invalid rows are skipped\nand rows already stored are not stored twice.", strings.Join(handler.ImportTables, ", ")), "db", "log")
+	// the table and file are accepted both before and after the flags
+	positional := []string{}
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional, args = append(positional, args[0]), args[1:]
+	}
+	cfg, err := fs.load(args)
+	if err != nil {
+		return err
+	}
+	positional = append(positional, fs.Args()...)
+	if len(positional) != 2 {
+		return fs.usageErr("expected <table> and <file>, got %v arguments", len(positional))
 	}
+	if !contains(handler.ImportTables, positional[0]) {
+		return fs.usageErr("can not import table %q, expected one of %v", positional[0], strings.Join(handler.ImportTables, ", "))
+	}
+
+	handler.ImportCSV(cfg, positional[0], positional[1])
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newBlockSource returns the block source configured on cfg, either the
+// directory of block files or the pool of RPC endpoints
+func newBlockSource(cfg config.Config) (query.Source, error) {
+	if cfg.BlocksDir != "" {
+		return query.NewFileSource(cfg.BlocksDir), nil
+	}
+
+	retry := query.DefaultRetryPolicy
+	retry.MaxAttempts = cfg.RPCMaxAttempts
+	return query.NewEndpointPool(cfg.RPCEndpoints, retry)
 }
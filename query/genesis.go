@@ -0,0 +1,146 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ClaimsDecoder walks a genesis file with the json tokenizer, decoding the
+// claims params and records one by one without holding the file in memory
+type ClaimsDecoder struct {
+	dec *json.Decoder
+	// OnParams is called with the claims params
+	OnParams func(ClaimsParams) error
+	// OnRecord is called with every claims record in the genesis order
+	OnRecord func(ClaimsRecord) error
+}
+
+// NewClaimsDecoder returns a decoder reading the genesis from r
+func NewClaimsDecoder(r io.Reader) *ClaimsDecoder {
+	return &ClaimsDecoder{dec: json.NewDecoder(r)}
+}
+
+// Decode walks to `app_state.claims` and calls the callbacks for its params and records.
+// The rest of the genesis is skipped token by token and not read past the claims.
+func (d *ClaimsDecoder) Decode() error {
+	found, err := d.walkObject(func(key string) (bool, error) {
+		if key != "app_state" {
+			return false, d.skip()
+		}
+		found, err := d.walkObject(func(key string) (bool, error) {
+			if key != "claims" {
+				return false, d.skip()
+			}
+			return true, d.decodeClaims()
+		})
+		if err != nil {
+			return false, fmt.Errorf("app_state: %v", err)
+		}
+		if !found {
+			return false, fmt.Errorf("app_state has no claims")
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("genesis has no app_state")
+	}
+	return nil
+}
+
+// decodeClaims decodes the claims object calling the callbacks
+func (d *ClaimsDecoder) decodeClaims() error {
+	_, err := d.walkObject(func(key string) (bool, error) {
+		switch key {
+		case "params":
+			var params ClaimsParams
+			if err := d.dec.Decode(&params); err != nil {
+				return false, fmt.Errorf("claims params: %v", err)
+			}
+			if d.OnParams != nil {
+				return false, d.OnParams(params)
+			}
+		case "claims_records":
+			if err := d.expectDelim('['); err != nil {
+				return false, fmt.Errorf("claims records: %v", err)
+			}
+			for i := 0; d.dec.More(); i++ {
+				var record ClaimsRecord
+				if err := d.dec.Decode(&record); err != nil {
+					return false, fmt.Errorf("claims record %v: %v", i, err)
+				}
+				if d.OnRecord != nil {
+					if err := d.OnRecord(record); err != nil {
+						return false, err
+					}
+				}
+			}
+			if err := d.expectDelim(']'); err != nil {
+				return false, fmt.Errorf("claims records: %v", err)
+			}
+		default:
+			return false, d.skip()
+		}
+		return false, nil
+	})
+	return err
+}
+
+// walkObject reads an object calling fn with each key, fn must consume its value.
+// The walk stops, leaving the rest of the object unread, once fn returns true.
+func (d *ClaimsDecoder) walkObject(fn func(key string) (bool, error)) (bool, error) {
+	if err := d.expectDelim('{'); err != nil {
+		return false, err
+	}
+	for d.dec.More() {
+		token, err := d.dec.Token()
+		if err != nil {
+			return false, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return false, fmt.Errorf("expected object key, got %v", token)
+		}
+		done, err := fn(key)
+		if err != nil || done {
+			return done, err
+		}
+	}
+	return false, d.expectDelim('}')
+}
+
+// skip consumes the next value without decoding it
+func (d *ClaimsDecoder) skip() error {
+	depth := 0
+	for {
+		token, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := token.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func (d *ClaimsDecoder) expectDelim(expected json.Delim) error {
+	token, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("expected %v, got %v", expected, token)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package query
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeGenesis decodes the genesis returning the params and records found
+func decodeGenesis(genesis string) ([]ClaimsParams, []ClaimsRecord, error) {
+	params, records := []ClaimsParams{}, []ClaimsRecord{}
+	d := NewClaimsDecoder(strings.NewReader(genesis))
+	d.OnParams = func(p ClaimsParams) error {
+		params = append(params, p)
+		return nil
+	}
+	d.OnRecord = func(r ClaimsRecord) error {
+		records = append(records, r)
+		return nil
+	}
+	return params, records, d.Decode()
+}
+
+func TestClaimsDecoder(t *testing.T) {
+	genesis, err := os.ReadFile("testdata/genesis.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, records, err := decodeGenesis(string(genesis))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantParams := ClaimsParams{
+		EnableClaims:       true,
+		AirdropStartTime:   time.Date(2022, 4, 27, 16, 0, 0, 0, time.UTC),
+		DurationUntilDecay: "2629800s",
+		DurationOfDecay:    "5259600s",
+		ClaimsDenom:        "aevmos",
+	}
+	if len(params) != 1 || !params[0].AirdropStartTime.Equal(wantParams.AirdropStartTime) {
+		t.Fatalf("got params %+v, want %+v", params, wantParams)
+	}
+	params[0].AirdropStartTime = wantParams.AirdropStartTime
+	if params[0] != wantParams {
+		t.Errorf("got params %+v, want %+v", params[0], wantParams)
+	}
+
+	// The records nested on other keys of the claims module are not decoded
+	wantRecords := []ClaimsRecord{
+		{Address: "evmos1a", ActionsCompleted: []bool{false, false, false, false}, InialClaimableAmount: "400"},
+		{Address: "evmos1b", ActionsCompleted: []bool{true, false, true, false}, InialClaimableAmount: "1000000000000000000"},
+		{Address: "evmos1c", ActionsCompleted: []bool{true, true, true, true}, InialClaimableAmount: "3"},
+	}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("got records %+v, want %+v", records, wantRecords)
+	}
+}
+
+func TestClaimsDecoderStopsAfterClaims(t *testing.T) {
+	// The records come before the params and the genesis is not read past the claims
+	genesis := `{"app_state": {"claims": {"claims_records": [{"address": "evmos1a", "initial_claimable_amount": "4"}],
+		"params": {"claims_denom": "aevmos"}}, "staking": not json`
+	params, records, err := decodeGenesis(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 1 || params[0].ClaimsDenom != "aevmos" || len(records) != 1 || records[0].Address != "evmos1a" {
+		t.Errorf("got params %+v and records %+v", params, records)
+	}
+}
+
+func TestClaimsDecoderErrors(t *testing.T) {
+	genesis, err := os.ReadFile("testdata/genesis.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := string(genesis[:strings.Index(string(genesis), `"evmos1c"`)])
+
+	tests := []struct {
+		name    string
+		genesis string
+		want    string
+	}{
+		{"no app_state", `{"chain_id": "evmos_9001-2", "initial_height": "1"}`, "genesis has no app_state"},
+		{"no claims", `{"app_state": {"auth": {"claims": {}}}}`, "app_state has no claims"},
+		{"not an object", `["app_state"]`, "expected {"},
+		{"invalid params", `{"app_state": {"claims": {"params": {"enable_claims": "yes"}}}}`, "claims params"},
+		{"invalid record", `{"app_state": {"claims": {"claims_records": [{"address": 1}]}}}`, "claims record 0"},
+		{"records not a list", `{"app_state": {"claims": {"claims_records": {}}}}`, "claims records"},
+		{"truncated skipped value", `{"chain_id": {"a": [1, 2`, "EOF"},
+		{"truncated records", truncated, "claims record 2"},
+		{"empty", "", "EOF"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := decodeGenesis(tc.genesis)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want it to contain %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestClaimsDecoderCallbackError(t *testing.T) {
+	genesis, err := os.ReadFile("testdata/genesis.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := errors.New("record rejected")
+	d := NewClaimsDecoder(strings.NewReader(string(genesis)))
+	records := 0
+	d.OnRecord = func(r ClaimsRecord) error {
+		records++
+		return rejected
+	}
+	if err := d.Decode(); err == nil || !strings.Contains(err.Error(), rejected.Error()) || records != 1 {
+		t.Errorf("got error %v after %v records, want the callback error after the first one", err, records)
+	}
+}
@@ -0,0 +1,180 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyWeight is the weight given to the latest request when updating
+// the moving average latency of an endpoint
+const latencyWeight = 0.2
+
+// StatsReporter is implemented by block sources that keep track of
+// the health of the nodes they query
+type StatsReporter interface {
+	ReportStats()
+}
+
+// EndpointStats holds the health stats of a single RPC node
+type EndpointStats struct {
+	URL                 string
+	Successes           int
+	Failures            int
+	ConsecutiveFailures int
+	AvgLatency          time.Duration
+}
+
+// score ranks the endpoint, lower is healthier.
+// Untried endpoints score 0 so they get a chance to prove themselves,
+// slow and erroring endpoints get demoted.
+func (s EndpointStats) score() float64 {
+	total := s.Successes + s.Failures
+	if total == 0 {
+		return 0
+	}
+	failureRate := float64(s.Failures) / float64(total)
+	return s.AvgLatency.Seconds() + 5*failureRate + float64(s.ConsecutiveFailures)
+}
+
+type endpoint struct {
+	source *RPCSource
+
+	mu    sync.Mutex
+	stats EndpointStats
+}
+
+func (e *endpoint) record(latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.stats.Failures++
+		e.stats.ConsecutiveFailures++
+		return
+	}
+	e.stats.ConsecutiveFailures = 0
+	if e.stats.Successes == 0 {
+		e.stats.AvgLatency = latency
+	} else {
+		e.stats.AvgLatency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(e.stats.AvgLatency))
+	}
+	e.stats.Successes++
+}
+
+func (e *endpoint) snapshot() EndpointStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// EndpointPool is a BlockSource that spreads requests over a list of RPC nodes.
+// Every request goes to the healthiest node first and fails over to the next
+// one when it errors out.
+type EndpointPool struct {
+	endpoints []*endpoint
+	retry     RetryPolicy
+}
+
+// NewEndpointPool returns an EndpointPool for the given node urls.
+// Every attempt of the retry policy goes over all the nodes once.
+func NewEndpointPool(urls []string, retry RetryPolicy) (*EndpointPool, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("at least one rpc endpoint is required")
+	}
+	pool := &EndpointPool{retry: retry}
+	for _, url := range urls {
+		source := NewRPCSource(url, retry)
+		pool.endpoints = append(pool.endpoints, &endpoint{
+			source: source,
+			stats:  EndpointStats{URL: source.url},
+		})
+	}
+	return pool, nil
+}
+
+// GetBlockResult queries `block_result` trying each node once, healthiest first,
+// and retries the whole round according to the pool retry policy
+func (p *EndpointPool) GetBlockResult(ctx context.Context, height int) (*BlockResult, error) {
+	var m *BlockResult
+	err := p.retry.Do(ctx, func() error {
+		return p.round(ctx, height, func(s *RPCSource) error {
+			var err error
+			m, err = s.fetchBlockResult(ctx, height)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error querying block result at height %v: %w", height, err)
+	}
+	return m, nil
+}
+
+// GetBlockTime queries the `block` header time the same way GetBlockResult does
+func (p *EndpointPool) GetBlockTime(ctx context.Context, height int) (time.Time, error) {
+	var t time.Time
+	err := p.retry.Do(ctx, func() error {
+		return p.round(ctx, height, func(s *RPCSource) error {
+			var err error
+			t, err = s.fetchBlockTime(ctx, height)
+			return err
+		})
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error querying block time at height %v: %w", height, err)
+	}
+	return t, nil
+}
+
+// round runs fetch against each node once, healthiest first, until one succeeds
+func (p *EndpointPool) round(ctx context.Context, height int, fetch func(s *RPCSource) error) error {
+	var lastErr error
+	for _, e := range p.ranked() {
+		start := time.Now()
+		err := fetch(e.source)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		e.record(time.Since(start), err)
+		if err == nil {
+			return nil
+		}
+		log.Printf("endpoint %v failed at height %v: %v", e.source.url, height, err)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// ranked returns the endpoints sorted by score keeping the configured
+// order between endpoints with the same score
+func (p *EndpointPool) ranked() []*endpoint {
+	scores := make(map[*endpoint]float64, len(p.endpoints))
+	for _, e := range p.endpoints {
+		scores[e] = e.snapshot().score()
+	}
+	ranked := make([]*endpoint, len(p.endpoints))
+	copy(ranked, p.endpoints)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]] < scores[ranked[j]]
+	})
+	return ranked
+}
+
+// Stats returns the current stats of every node in the configured order
+func (p *EndpointPool) Stats() []EndpointStats {
+	stats := make([]EndpointStats, len(p.endpoints))
+	for i, e := range p.endpoints {
+		stats[i] = e.snapshot()
+	}
+	return stats
+}
+
+// ReportStats logs the success and latency stats of every node
+func (p *EndpointPool) ReportStats() {
+	log.Println("rpc endpoint stats:")
+	for _, s := range p.Stats() {
+		log.Printf("  %v: %v successes, %v failures, avg latency %v", s.URL, s.Successes, s.Failures, s.AvgLatency)
+	}
+}
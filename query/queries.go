@@ -1,55 +1,196 @@
 package query
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"io/ioutil"
-	"log"
 )
 
-var client = &http.Client{}
-var clientUrl = "https://tendermint.bd.evmos.org:26657/"
+// DefaultClientURL is the tendermint RPC node used when no other is provided
+const DefaultClientURL = "https://tendermint.bd.evmos.org:26657/"
+
+// BlockSource fetches block results by height
+type BlockSource interface {
+	GetBlockResult(ctx context.Context, height int) (*BlockResult, error)
+}
+
+// BlockTimeSource fetches the time of the block header by height
+type BlockTimeSource interface {
+	GetBlockTime(ctx context.Context, height int) (time.Time, error)
+}
+
+// Source queries both block results and block headers
+type Source interface {
+	BlockSource
+	BlockTimeSource
+}
+
+// RPCSource queries block results from a tendermint RPC node
+type RPCSource struct {
+	client *http.Client
+	url    string
+	retry  RetryPolicy
+}
+
+// NewRPCSource returns a BlockSource backed by the tendermint RPC node at url
+func NewRPCSource(url string, retry RetryPolicy) *RPCSource {
+	return &RPCSource{
+		client: &http.Client{},
+		url:    strings.TrimSuffix(url, "/") + "/",
+		retry:  retry,
+	}
+}
 
 // GetBlockResult queries `block_result` directly from node
-// if the request or parser fail the function  will retry 3 times
-func GetBlockResult(height string, try int) (*BlockResult, error) {
-	try += try
+// retrying according to the source retry policy
+func (s *RPCSource) GetBlockResult(ctx context.Context, height int) (*BlockResult, error) {
+	var m *BlockResult
+	err := s.retry.Do(ctx, func() error {
+		var err error
+		m, err = s.fetchBlockResult(ctx, height)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error querying block result at height %v: %w", height, err)
+	}
+	return m, nil
+}
+
+// GetBlockTime queries the `block` header time directly from node
+// retrying according to the source retry policy
+func (s *RPCSource) GetBlockTime(ctx context.Context, height int) (time.Time, error) {
+	var t time.Time
+	err := s.retry.Do(ctx, func() error {
+		var err error
+		t, err = s.fetchBlockTime(ctx, height)
+		return err
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error querying block time at height %v: %w", height, err)
+	}
+	return t, nil
+}
+
+// fetchBlockResult makes a single `block_result` request without retrying
+func (s *RPCSource) fetchBlockResult(ctx context.Context, height int) (*BlockResult, error) {
 	balance_start := "block_results?height="
-	url := balance_start + height
-	body, err := makeRequest(url, height)
+	url := balance_start + strconv.Itoa(height)
+	body, err := s.makeRequest(ctx, url)
 	if err != nil {
-		if try >= 3 {
-			return nil, err
-		}
-		time.Sleep(1000)
-		return GetBlockResult(height, try)
+		return nil, err
 	}
 	m := &BlockResult{}
 	err = json.Unmarshal(body, &m)
 	if err != nil {
-		if try >= 3 {
-			return nil, err
-		}
-		time.Sleep(1000)
-		return GetBlockResult(height, try)
+		return nil, err
+	}
+	if m.Error != nil {
+		return nil, m.Error
 	}
 	return m, nil
 }
 
-func makeRequest(endpoint string, height string) ([]byte, error) {
-	req, _ := http.NewRequest("GET", clientUrl+endpoint, nil)
-	res, err := client.Do(req)
+// fetchBlockTime makes a single `block` request without retrying
+func (s *RPCSource) fetchBlockTime(ctx context.Context, height int) (time.Time, error) {
+	body, err := s.makeRequest(ctx, "block?height="+strconv.Itoa(height))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseBlockTime(body, height)
+}
+
+func (s *RPCSource) makeRequest(ctx context.Context, endpoint string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req)
 	if err != nil {
-		log.Println("Error http request", endpoint, err)
 		return nil, err
 	}
 	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		log.Println("Error reading the response body", endpoint, err)
 		return nil, err
 	}
+	if res.StatusCode != http.StatusOK {
+		// tendermint answers rpc errors with a 500 status code
+		m := &BlockResult{}
+		if json.Unmarshal(body, &m) == nil && m.Error != nil {
+			return nil, m.Error
+		}
+		return nil, &StatusError{
+			StatusCode: res.StatusCode,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
 	return body, nil
 }
+
+// parseBlockTime returns the header time of a `block` response
+func parseBlockTime(body []byte, height int) (time.Time, error) {
+	m := &BlockResponse{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return time.Time{}, err
+	}
+	if m.Error != nil {
+		return time.Time{}, m.Error
+	}
+	if m.Result.Block.Header.Height != strconv.Itoa(height) {
+		return time.Time{}, fmt.Errorf("expected block %v, got %q", height, m.Result.Block.Header.Height)
+	}
+	return m.Result.Block.Header.Time, nil
+}
+
+// FileSource reads block results from a directory of `<height>.json` files,
+// each holding the raw `block_results` response for that height, and block
+// headers from `<height>.block.json` files holding the raw `block` response.
+// It is meant to be used with local fixtures or archived responses.
+type FileSource struct {
+	dir string
+}
+
+// NewFileSource returns a BlockSource backed by the files in dir
+func NewFileSource(dir string) *FileSource {
+	return &FileSource{dir: dir}
+}
+
+// GetBlockResult reads and parses `<dir>/<height>.json`
+func (s *FileSource) GetBlockResult(ctx context.Context, height int) (*BlockResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(filepath.Join(s.dir, strconv.Itoa(height)+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading block result for height %v: %v", height, err)
+	}
+	m := &BlockResult{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("error parsing block result for height %v: %v", height, err)
+	}
+	return m, nil
+}
+
+// GetBlockTime reads and parses `<dir>/<height>.block.json`
+func (s *FileSource) GetBlockTime(ctx context.Context, height int) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	body, err := os.ReadFile(filepath.Join(s.dir, strconv.Itoa(height)+".block.json"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error reading block for height %v: %v", height, err)
+	}
+	t, err := parseBlockTime(body, height)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing block for height %v: %v", height, err)
+	}
+	return t, nil
+}
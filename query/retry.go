@@ -0,0 +1,133 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy defines how many times and how often a failed request is retried
+type RetryPolicy struct {
+	// MaxAttempts is the total amount of attempts including the first one
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, it doubles on every attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used by the RPC sources when no other policy is provided
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// StatusError is returned when the node answers with a non 200 status code
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is the delay requested by the node through the Retry-After header
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %v", e.StatusCode)
+}
+
+// RPCError is the error returned by the node on the json rpc response,
+// e.g. when the requested height is not available
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %v: %v %v", e.Code, e.Message, e.Data)
+}
+
+// IsRetryable reports whether a request that failed with err could succeed if retried.
+// Rate limits, server errors, network errors and malformed responses are retryable,
+// rpc errors, client errors and cancellations are not.
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode == http.StatusRequestTimeout ||
+			statusErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	return true
+}
+
+// Do calls fn until it succeeds, returns a non retryable error, the attempts
+// are exhausted or the context is cancelled
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !IsRetryable(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the delay before the given retry: an exponential delay
+// capped at MaxDelay, half of it randomized to avoid workers retrying in lockstep
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter parses the Retry-After header, either in seconds or as an http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
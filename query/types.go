@@ -1,10 +1,53 @@
 package query
 
-import "encoding/base64"
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrMissingAttribute is returned when an event has no attribute with the requested key
+	ErrMissingAttribute = errors.New("missing attribute")
+	// ErrDuplicateAttribute is returned when an event has the requested key more than once with different values
+	ErrDuplicateAttribute = errors.New("duplicate attribute")
+)
+
+// AttributeError is returned when an event attribute can not be read
+type AttributeError struct {
+	EventType string
+	Key       string
+	Err       error
+}
+
+func (e *AttributeError) Error() string {
+	return fmt.Sprintf("%v %q on %v event", e.Err, e.Key, e.EventType)
+}
+
+func (e *AttributeError) Unwrap() error {
+	return e.Err
+}
+
+// BlockResponse is the `block` response, only the header is decoded
+type BlockResponse struct {
+	Result struct {
+		Block struct {
+			Header BlockHeader `json:"header"`
+		} `json:"block"`
+	} `json:"result"`
+	Error *RPCError `json:"error,omitempty"`
+}
+
+type BlockHeader struct {
+	Height string    `json:"height"`
+	Time   time.Time `json:"time"`
+}
 
 type BlockResult struct {
-	Result Result `json:"result"`
-	Height int64  `json:"height"`
+	Result Result    `json:"result"`
+	Height int64     `json:"height"`
+	Error  *RPCError `json:"error,omitempty"`
 }
 
 type Result struct {
@@ -20,17 +63,55 @@ type Event struct {
 	Attributes []Attribute `json:"attributes"`
 }
 
+// DecodeAttributes decodes the base64 keys and values of the attributes
 func (be *Event) DecodeAttributes() error {
 	for i := range be.Attributes {
+		key, err := base64.StdEncoding.DecodeString(be.Attributes[i].Key)
+		if err != nil {
+			return err
+		}
 		decoded, err := base64.StdEncoding.DecodeString(be.Attributes[i].Value)
 		if err != nil {
 			return err
 		}
+		be.Attributes[i].Key = string(key)
 		be.Attributes[i].Value = string(decoded)
 	}
 	return nil
 }
 
+// Attribute returns the value of the attribute with the given key.
+// It fails with an *AttributeError if the key is missing or holds different values.
+func (be *Event) Attribute(key string) (string, error) {
+	value, found := "", false
+	for _, a := range be.Attributes {
+		if a.Key != key {
+			continue
+		}
+		if found && a.Value != value {
+			return "", &AttributeError{EventType: be.Type, Key: key, Err: ErrDuplicateAttribute}
+		}
+		value, found = a.Value, true
+	}
+	if !found {
+		return "", &AttributeError{EventType: be.Type, Key: key, Err: ErrMissingAttribute}
+	}
+	return value, nil
+}
+
+// AttributeValues returns the values of the given keys in the same order
+func (be *Event) AttributeValues(keys ...string) ([]string, error) {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		value, err := be.Attribute(key)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
 type Attribute struct {
 	Key   string `json:"key,omitempty"`
 	Value string `json:"value,omitempty"`
@@ -54,9 +135,19 @@ type AppState struct {
 }
 
 type Claims struct {
+	Params        ClaimsParams   `json:"params"`
 	ClaimsRecords []ClaimsRecord `json:"claims_records"`
 }
 
+// ClaimsParams durations are protobuf json durations, e.g. `2629800s`
+type ClaimsParams struct {
+	EnableClaims       bool      `json:"enable_claims"`
+	AirdropStartTime   time.Time `json:"airdrop_start_time"`
+	DurationUntilDecay string    `json:"duration_until_decay"`
+	DurationOfDecay    string    `json:"duration_of_decay"`
+	ClaimsDenom        string    `json:"claims_denom"`
+}
+
 type ClaimsRecord struct {
 	Address              string `json:"address"`
 	ActionsCompleted     []bool `json:"actions_completed"`
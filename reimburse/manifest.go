@@ -0,0 +1,78 @@
+package reimburse
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Manifest records which addresses are paid on which chunk file
+type Manifest struct {
+	FromAddress string `json:"from_address"`
+	Denom       string `json:"denom"`
+	// Dust is the amount payments had to exceed to be included
+	Dust       string          `json:"dust"`
+	ChunkSize  int             `json:"chunk_size"`
+	Total      string          `json:"total"`
+	Recipients int             `json:"recipients"`
+	Skipped    int             `json:"skipped"`
+	Chunks     []ManifestChunk `json:"chunks"`
+	// Flagged are the losses left out because of the anomalies of their account
+	Flagged []Flagged `json:"flagged"`
+}
+
+type ManifestChunk struct {
+	Number   int               `json:"number"`
+	File     string            `json:"file"`
+	Total    string            `json:"total"`
+	Payments []ManifestPayment `json:"payments"`
+}
+
+type ManifestPayment struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+}
+
+// Flagged is a loss left out of the chunks to be reviewed by hand
+type Flagged struct {
+	Address   string `json:"address"`
+	Amount    string `json:"amount"`
+	Anomalies string `json:"anomalies"`
+}
+
+// ChunkFilePattern matches the names returned by ChunkFile
+const ChunkFilePattern = "chunk-*.json"
+
+// ChunkFile returns the name of the transaction file of a chunk
+func ChunkFile(chunk Chunk) string {
+	return fmt.Sprintf("chunk-%04d.json", chunk.Number)
+}
+
+// NewManifest returns the manifest of the chunks
+func NewManifest(chunks []Chunk, from, denom string, dust *big.Int, chunkSize, skipped int, flagged []Flagged) Manifest {
+	m := Manifest{
+		FromAddress: from,
+		Denom:       denom,
+		Dust:        dust.String(),
+		ChunkSize:   chunkSize,
+		Skipped:     skipped,
+		Chunks:      []ManifestChunk{},
+		Flagged:     flagged,
+	}
+	total := big.NewInt(0)
+	for _, chunk := range chunks {
+		mc := ManifestChunk{
+			Number:   chunk.Number,
+			File:     ChunkFile(chunk),
+			Total:    chunk.Total.String(),
+			Payments: []ManifestPayment{},
+		}
+		for _, p := range chunk.Payments {
+			mc.Payments = append(mc.Payments, ManifestPayment{Address: p.Address, Amount: p.Amount.String()})
+		}
+		total.Add(total, chunk.Total)
+		m.Recipients += len(chunk.Payments)
+		m.Chunks = append(m.Chunks, mc)
+	}
+	m.Total = total.String()
+	return m
+}
@@ -0,0 +1,119 @@
+// Package reimburse builds the bank multi-send transactions paying back the decay losses
+package reimburse
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Payment is the amount owed to an address
+type Payment struct {
+	Address string
+	Amount  *big.Int
+}
+
+// Chunk is a group of payments sent on a single transaction
+type Chunk struct {
+	Number   int
+	Total    *big.Int
+	Payments []Payment
+}
+
+// Split groups the payments in chunks of at most size payments, keeping their order
+func Split(payments []Payment, size int) []Chunk {
+	chunks := []Chunk{}
+	for i := 0; i < len(payments); i += size {
+		end := i + size
+		if end > len(payments) {
+			end = len(payments)
+		}
+		chunk := Chunk{
+			Number:   len(chunks) + 1,
+			Total:    big.NewInt(0),
+			Payments: payments[i:end],
+		}
+		for _, p := range chunk.Payments {
+			chunk.Total.Add(chunk.Total, p.Amount)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// Tx is an unsigned cosmos sdk transaction as printed by `tx --generate-only`
+type Tx struct {
+	Body       TxBody   `json:"body"`
+	AuthInfo   AuthInfo `json:"auth_info"`
+	Signatures []string `json:"signatures"`
+}
+
+type TxBody struct {
+	Messages                    []MsgMultiSend `json:"messages"`
+	Memo                        string         `json:"memo"`
+	TimeoutHeight               string         `json:"timeout_height"`
+	ExtensionOptions            []struct{}     `json:"extension_options"`
+	NonCriticalExtensionOptions []struct{}     `json:"non_critical_extension_options"`
+}
+
+type AuthInfo struct {
+	SignerInfos []struct{} `json:"signer_infos"`
+	Fee         Fee        `json:"fee"`
+}
+
+type Fee struct {
+	Amount   []Coin `json:"amount"`
+	GasLimit string `json:"gas_limit"`
+	Payer    string `json:"payer"`
+	Granter  string `json:"granter"`
+}
+
+// MsgMultiSend is the bank multi-send message, inputs must add up to the outputs
+type MsgMultiSend struct {
+	Type    string  `json:"@type"`
+	Inputs  []Input `json:"inputs"`
+	Outputs []Input `json:"outputs"`
+}
+
+// Input is an address with its coins, used both for the inputs and outputs of a multi-send
+type Input struct {
+	Address string `json:"address"`
+	Coins   []Coin `json:"coins"`
+}
+
+type Coin struct {
+	Denom  string `json:"denom"`
+	Amount string `json:"amount"`
+}
+
+// NewTx returns the unsigned transaction sending the chunk payments from the given address.
+// The fee and gas are left empty to be set when signing.
+func NewTx(chunk Chunk, from, denom, memo string) (Tx, error) {
+	if len(chunk.Payments) == 0 {
+		return Tx{}, fmt.Errorf("chunk %v has no payments", chunk.Number)
+	}
+	msg := MsgMultiSend{
+		Type:   "/cosmos.bank.v1beta1.MsgMultiSend",
+		Inputs: []Input{{Address: from, Coins: []Coin{{Denom: denom, Amount: chunk.Total.String()}}}},
+	}
+	for _, p := range chunk.Payments {
+		if p.Amount.Sign() <= 0 {
+			return Tx{}, fmt.Errorf("non positive payment of %v to %v", p.Amount, p.Address)
+		}
+		msg.Outputs = append(msg.Outputs, Input{Address: p.Address, Coins: []Coin{{Denom: denom, Amount: p.Amount.String()}}})
+	}
+
+	return Tx{
+		Body: TxBody{
+			Messages:                    []MsgMultiSend{msg},
+			Memo:                        memo,
+			TimeoutHeight:               "0",
+			ExtensionOptions:            []struct{}{},
+			NonCriticalExtensionOptions: []struct{}{},
+		},
+		AuthInfo: AuthInfo{
+			SignerInfos: []struct{}{},
+			Fee:         Fee{Amount: []Coin{}, GasLimit: "0"},
+		},
+		Signatures: []string{},
+	}, nil
+}